@@ -2,9 +2,13 @@ package apiai
 
 import (
 	"encoding/json"
+	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,6 +17,24 @@ import (
 type APIClient struct {
 	BaseURL    *url.URL
 	HTTPClient *http.Client // change this to client with authenticate
+
+	// ApplyDefaults sends the schema default of optional parameters
+	// the model did not provide
+	ApplyDefaults bool
+
+	// Timeout limits every function call, zero means no limit.
+	// FunctionTimeouts overrides it by function name.
+	Timeout          time.Duration
+	FunctionTimeouts map[string]time.Duration
+
+	// ValidateArguments checks arguments against the function schema before
+	// the call, CoerceArguments also fixes safe mismatches, see ValidateArguments
+	ValidateArguments bool
+	CoerceArguments   bool
+
+	// Server selects among operation level servers by description,
+	// its variables apply to them, see NewAPIClientFromSpec
+	Server ServerSelection
 }
 
 // NewAPIClient creates a new API client
@@ -30,13 +52,43 @@ func NewAPIClient(baseURL string, authConfig *AuthConfig, opts ...func(*http.Cli
 
 // FunctionDefinition represents an LLM function definition
 type FunctionDefinition struct {
-	Name        string   `json:"name" yaml:"name"`
-	Description string   `json:"description" yaml:"description"`
-	Parameters  Schema   `json:"parameters" yaml:"parameters"`
-	OapiMethod  string   `json:"-" yaml:"-"`
-	OapiPath    string   `json:"-" yaml:"-"`
-	PathParams  []string `json:"-" yaml:"-"`
-	QueryParams []string `json:"-" yaml:"-"`
+	Name         string   `json:"name" yaml:"name"`
+	Description  string   `json:"description" yaml:"description"`
+	Parameters   Schema   `json:"parameters" yaml:"parameters"`
+	OperationID  string   `json:"-" yaml:"-"`
+	OapiMethod   string   `json:"-" yaml:"-"`
+	OapiPath     string   `json:"-" yaml:"-"`
+	PathParams   []string `json:"-" yaml:"-"`
+	QueryParams  []string `json:"-" yaml:"-"`
+	HeaderParams []string `json:"-" yaml:"-"`
+	CookieParams []string `json:"-" yaml:"-"`
+
+	// BoundArgs holds fixed parameter values that are not exposed to the model
+	BoundArgs map[string]any `json:"-" yaml:"-"`
+
+	// OapiParams holds the resolved parameters by name, used to serialize argument values
+	OapiParams map[string]*Parameter `json:"-" yaml:"-"`
+
+	// RequestContentType is the media type the request body is sent with
+	RequestContentType string              `json:"-" yaml:"-"`
+	RequestEncoding    map[string]Encoding `json:"-" yaml:"-"`
+
+	// FileParams lists binary request body properties hidden from the model,
+	// the application supplies them as FilePart arguments. It is "requestBody"
+	// when the whole body is binary.
+	FileParams []string `json:"-" yaml:"-"`
+
+	// Responses holds the resolved responses by status code, range or "default",
+	// see Response
+	Responses map[string]*FunctionResponse `json:"-" yaml:"-"`
+
+	// Servers are the operation or path level servers that override
+	// the client base URL, see APIClient.Server
+	Servers []Server `json:"-" yaml:"-"`
+
+	// Security lists the alternative security requirements of the operation,
+	// nil when the spec declares none, empty when the operation needs no auth
+	Security []SecurityRequirement `json:"-" yaml:"-"`
 }
 
 // OpenAPISpec represents an OpenAPI 3.x specification
@@ -44,7 +96,19 @@ type OpenAPISpec struct {
 	OpenAPI    string              `json:"openapi" yaml:"openapi"`
 	Paths      map[string]PathItem `json:"paths" yaml:"paths"`
 	Info       Info                `json:"info" yaml:"info"`
+	Servers    []Server            `json:"servers,omitempty" yaml:"servers,omitempty"`
 	Components *Components         `json:"components,omitempty" yaml:"components,omitempty"`
+	Webhooks   map[string]PathItem `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+
+	// Security applies to operations that do not declare their own
+	Security []SecurityRequirement `json:"security,omitempty" yaml:"security,omitempty"`
+}
+
+// Server represents a server the API is available at
+type Server struct {
+	URL         string                    `json:"url" yaml:"url"`
+	Description string                    `json:"description,omitempty" yaml:"description,omitempty"`
+	Variables   map[string]ServerVariable `json:"variables,omitempty" yaml:"variables,omitempty"`
 }
 
 // Info contains API metadata
@@ -56,45 +120,81 @@ type Info struct {
 
 // Components contains reusable objects
 type Components struct {
-	Parameters map[string]Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Schemas         map[string]*Schema         `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+	Responses       map[string]*Response       `json:"responses,omitempty" yaml:"responses,omitempty"`
+	Parameters      map[string]Parameter       `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Examples        map[string]*Example        `json:"examples,omitempty" yaml:"examples,omitempty"`
+	RequestBodies   map[string]*RequestBody    `json:"requestBodies,omitempty" yaml:"requestBodies,omitempty"`
+	Headers         map[string]*Header         `json:"headers,omitempty" yaml:"headers,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty" yaml:"securitySchemes,omitempty"`
 }
 
 // PathItem represents a path in the OpenAPI spec
 type PathItem struct {
-	Get    *Operation `json:"get" yaml:"get"`
-	Post   *Operation `json:"post" yaml:"post"`
-	Put    *Operation `json:"put" yaml:"put"`
-	Delete *Operation `json:"delete" yaml:"delete"`
-	Patch  *Operation `json:"patch" yaml:"patch"`
+	Get     *Operation `json:"get" yaml:"get"`
+	Post    *Operation `json:"post" yaml:"post"`
+	Put     *Operation `json:"put" yaml:"put"`
+	Delete  *Operation `json:"delete" yaml:"delete"`
+	Patch   *Operation `json:"patch" yaml:"patch"`
+	Head    *Operation `json:"head,omitempty" yaml:"head,omitempty"`
+	Options *Operation `json:"options,omitempty" yaml:"options,omitempty"`
+	Trace   *Operation `json:"trace,omitempty" yaml:"trace,omitempty"`
+
+	// Parameters shared by all operations of the path
+	Parameters []Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+
+	// Servers override the spec servers for all operations of the path
+	Servers []Server `json:"servers,omitempty" yaml:"servers,omitempty"`
+}
+
+// operationMethods lists the HTTP methods of path item operations in spec order
+var operationMethods = []string{
+	http.MethodGet,
+	http.MethodPut,
+	http.MethodPost,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodHead,
+	http.MethodPatch,
+	http.MethodTrace,
 }
 
 // Helper to get operations from path item
 func (p *PathItem) getOperations() map[string]*Operation {
 	ops := make(map[string]*Operation)
-	if p.Get != nil {
-		ops["GET"] = p.Get
-	}
-	if p.Post != nil {
-		ops["POST"] = p.Post
-	}
-	if p.Put != nil {
-		ops["PUT"] = p.Put
-	}
-	if p.Delete != nil {
-		ops["DELETE"] = p.Delete
-	}
-	if p.Patch != nil {
-		ops["PATCH"] = p.Patch
+	for method, op := range map[string]*Operation{
+		http.MethodGet:     p.Get,
+		http.MethodPost:    p.Post,
+		http.MethodPut:     p.Put,
+		http.MethodDelete:  p.Delete,
+		http.MethodPatch:   p.Patch,
+		http.MethodHead:    p.Head,
+		http.MethodOptions: p.Options,
+		http.MethodTrace:   p.Trace,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
 	}
 	return ops
 }
 
 // Operation represents an API operation
 type Operation struct {
+	OperationID string       `json:"operationId,omitempty" yaml:"operationId,omitempty"`
 	Summary     string       `json:"summary" yaml:"summary"`
 	Description string       `json:"description" yaml:"description"`
 	Parameters  []Parameter  `json:"parameters,omitempty" yaml:"parameters,omitempty"`
 	RequestBody *RequestBody `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+
+	// Responses by status code, "1XX".."5XX" ranges or "default"
+	Responses map[string]*Response `json:"responses,omitempty" yaml:"responses,omitempty"`
+
+	// Servers override the path and spec servers for the operation
+	Servers []Server `json:"servers,omitempty" yaml:"servers,omitempty"`
+
+	// Security overrides the spec security, an empty list disables it
+	Security []SecurityRequirement `json:"security,omitempty" yaml:"security,omitempty"`
 }
 
 // Parameter represents an API parameter
@@ -105,50 +205,244 @@ type Parameter struct {
 	Required    bool    `json:"required" yaml:"required"`
 	Schema      *Schema `json:"schema" yaml:"schema"`
 	Ref         string  `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+
+	// Serialization of array and object values, defaults depend on In
+	Style         string `json:"style,omitempty" yaml:"style,omitempty"`
+	Explode       *bool  `json:"explode,omitempty" yaml:"explode,omitempty"`
+	AllowReserved bool   `json:"allowReserved,omitempty" yaml:"allowReserved,omitempty"`
 }
 
 // RequestBody represents the request body definition
 type RequestBody struct {
-	Content map[string]MediaType `json:"content" yaml:"content"`
+	Description string               `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty" yaml:"required,omitempty"`
+	Content     map[string]MediaType `json:"content" yaml:"content"`
+	Ref         string               `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+}
+
+// Response represents a single response definition
+type Response struct {
+	Description string               `json:"description" yaml:"description"`
+	Headers     map[string]*Header   `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty" yaml:"content,omitempty"`
+	Ref         string               `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+}
+
+// Header represents a response or encoding header
+type Header struct {
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool    `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Ref         string  `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+}
+
+// Example represents a named example value
+type Example struct {
+	Summary       string `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description   string `json:"description,omitempty" yaml:"description,omitempty"`
+	Value         any    `json:"value,omitempty" yaml:"value,omitempty"`
+	ExternalValue string `json:"externalValue,omitempty" yaml:"externalValue,omitempty"`
+	Ref           string `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+}
+
+// SecurityScheme represents a security scheme declared in components
+type SecurityScheme struct {
+	Type             string      `json:"type" yaml:"type"`
+	Description      string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Name             string      `json:"name,omitempty" yaml:"name,omitempty"`
+	In               string      `json:"in,omitempty" yaml:"in,omitempty"`
+	Scheme           string      `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+	BearerFormat     string      `json:"bearerFormat,omitempty" yaml:"bearerFormat,omitempty"`
+	Flows            *OAuthFlows `json:"flows,omitempty" yaml:"flows,omitempty"`
+	OpenIDConnectURL string      `json:"openIdConnectUrl,omitempty" yaml:"openIdConnectUrl,omitempty"`
+	Ref              string      `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+}
+
+// OAuthFlows lists the OAuth2 flows supported by a security scheme
+type OAuthFlows struct {
+	Implicit          *OAuthFlow `json:"implicit,omitempty" yaml:"implicit,omitempty"`
+	Password          *OAuthFlow `json:"password,omitempty" yaml:"password,omitempty"`
+	ClientCredentials *OAuthFlow `json:"clientCredentials,omitempty" yaml:"clientCredentials,omitempty"`
+	AuthorizationCode *OAuthFlow `json:"authorizationCode,omitempty" yaml:"authorizationCode,omitempty"`
+}
+
+// OAuthFlow describes a single OAuth2 flow
+type OAuthFlow struct {
+	AuthorizationURL string            `json:"authorizationUrl,omitempty" yaml:"authorizationUrl,omitempty"`
+	TokenURL         string            `json:"tokenUrl,omitempty" yaml:"tokenUrl,omitempty"`
+	RefreshURL       string            `json:"refreshUrl,omitempty" yaml:"refreshUrl,omitempty"`
+	Scopes           map[string]string `json:"scopes" yaml:"scopes"`
 }
 
 // MediaType represents media type in request/response body
 type MediaType struct {
-	Schema *Schema `json:"schema" yaml:"schema"`
+	Schema   *Schema             `json:"schema" yaml:"schema"`
+	Encoding map[string]Encoding `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+}
+
+// Encoding describes how a property of a form or multipart request body is serialized
+type Encoding struct {
+	ContentType   string             `json:"contentType,omitempty" yaml:"contentType,omitempty"`
+	Headers       map[string]*Header `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Style         string             `json:"style,omitempty" yaml:"style,omitempty"`
+	Explode       *bool              `json:"explode,omitempty" yaml:"explode,omitempty"`
+	AllowReserved bool               `json:"allowReserved,omitempty" yaml:"allowReserved,omitempty"`
 }
 
 // Schema represents JSON Schema
 type Schema struct {
-	Type        string             `json:"type" yaml:"type"`
+	Ref         string             `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty" yaml:"type,omitempty"`
 	Properties  map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
 	Required    []string           `json:"required,omitempty" yaml:"required,omitempty"`
 	Format      string             `json:"format,omitempty" yaml:"format,omitempty"`
 	Description string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty" yaml:"nullable,omitempty"`
+	Enum        []any              `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Const       any                `json:"const,omitempty" yaml:"const,omitempty"`
+	Default     any                `json:"default,omitempty" yaml:"default,omitempty"`
+	Example     any                `json:"example,omitempty" yaml:"example,omitempty"`
+	Examples    []any              `json:"examples,omitempty" yaml:"examples,omitempty"`
+	Defs        map[string]*Schema `json:"$defs,omitempty" yaml:"$defs,omitempty"`
+
+	// Arrays and objects
+	Items                *Schema               `json:"items,omitempty" yaml:"items,omitempty"`
+	AdditionalProperties *AdditionalProperties `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+
+	// Validation
+	Minimum          *float64 `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	ExclusiveMinimum bool     `json:"exclusiveMinimum,omitempty" yaml:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum bool     `json:"exclusiveMaximum,omitempty" yaml:"exclusiveMaximum,omitempty"`
+	MultipleOf       *float64 `json:"multipleOf,omitempty" yaml:"multipleOf,omitempty"`
+	MinLength        *int     `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength        *int     `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	Pattern          string   `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	MinItems         *int     `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+	MaxItems         *int     `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+	UniqueItems      bool     `json:"uniqueItems,omitempty" yaml:"uniqueItems,omitempty"`
+
+	// Composition
+	AllOf []*Schema `json:"allOf,omitempty" yaml:"allOf,omitempty"`
+	OneOf []*Schema `json:"oneOf,omitempty" yaml:"oneOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
+	Not   *Schema   `json:"not,omitempty" yaml:"not,omitempty"`
+
+	// OpenAPI 3.1 forms as parsed, before version-aware normalization
+	typeList              []string
+	exclusiveMinimumValue *float64
+	exclusiveMaximumValue *float64
 }
 
-// resolveParameterRef resolves a $ref parameter to its actual definition
-func resolveParameterRef(param Parameter, spec *OpenAPISpec) Parameter {
-	if param.Ref != "" && spec.Components != nil && spec.Components.Parameters != nil {
-		// Extract parameter name from $ref, e.g., "#/components/parameters/offsetParam" -> "offsetParam"
-		refParts := strings.Split(param.Ref, "/")
-		if len(refParts) == 4 && refParts[0] == "#" && refParts[1] == "components" && refParts[2] == "parameters" {
-			paramName := refParts[3]
-			if referencedParam, exists := spec.Components.Parameters[paramName]; exists {
-				// Return the referenced parameter
-				return referencedParam
-			}
+// AdditionalProperties is either a boolean or a schema for object properties
+// not listed in Properties
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (a AdditionalProperties) MarshalJSON() ([]byte, error) {
+	if a.Schema != nil {
+		return json.Marshal(a.Schema)
+	}
+	return json.Marshal(a.Allowed)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (a *AdditionalProperties) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		*a = AdditionalProperties{Allowed: allowed}
+		return nil
+	}
+	schema := &Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return err
+	}
+	*a = AdditionalProperties{Allowed: true, Schema: schema}
+	return nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (a *AdditionalProperties) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!bool" {
+		var allowed bool
+		if err := node.Decode(&allowed); err != nil {
+			return err
 		}
+		*a = AdditionalProperties{Allowed: allowed}
+		return nil
 	}
-	// Return the original parameter if no reference is found
-	return param
+	schema := &Schema{}
+	if err := node.Decode(schema); err != nil {
+		return err
+	}
+	*a = AdditionalProperties{Allowed: true, Schema: schema}
+	return nil
 }
 
-// ConvertOpenAPIToFunctions converts OpenAPI spec to LLM function definitions
-func ConvertOpenAPIToFunctions(spec *OpenAPISpec) map[string]*FunctionDefinition {
-	functions := map[string]*FunctionDefinition{}
+// ConvertOption configures ConvertOpenAPIToFunctions
+type ConvertOption func(*convertOptions)
+
+type convertOptions struct {
+	flattenAllOf bool
+	namer        FunctionNamer
+	onRename     func(FunctionRename)
+	bound        map[boundParameter]any
+	mediaTypes   []string
+	returnsHint  bool
+}
+
+type boundParameter struct {
+	in   string
+	name string
+}
+
+// ignoredHeaderParams are header parameters the spec says to ignore
+var ignoredHeaderParams = map[string]bool{
+	"Accept":        true,
+	"Content-Type":  true,
+	"Authorization": true,
+}
+
+// WithFlattenAllOf merges allOf subschemas into a single flat schema,
+// for models that handle flat objects better than composition
+func WithFlattenAllOf() ConvertOption {
+	return func(o *convertOptions) {
+		o.flattenAllOf = true
+	}
+}
+
+// WithBoundParameter binds the parameter with location in ("path", "query",
+// "header" or "cookie") and name to a fixed value. Bound parameters are hidden
+// from the tool schema and always sent with value, e.g. a tenant header.
+func WithBoundParameter(in, name string, value any) ConvertOption {
+	return func(o *convertOptions) {
+		if o.bound == nil {
+			o.bound = map[boundParameter]any{}
+		}
+		o.bound[boundParameter{in: in, name: name}] = value
+	}
+}
+
+// ConvertOpenAPIToFunctions converts OpenAPI spec to LLM function definitions.
+// It fails if a $ref in the spec can not be resolved.
+func ConvertOpenAPIToFunctions(spec *OpenAPISpec, opts ...ConvertOption) (map[string]*FunctionDefinition, error) {
+	options := &convertOptions{namer: OperationIDNamer}
+	for _, opt := range opts {
+		opt(options)
+	}
 
-	for path, pathItem := range spec.Paths {
-		for method, op := range pathItem.getOperations() {
+	functions := map[string]*FunctionDefinition{}
+	names := newFunctionNames(options.namer, options.onRename)
+
+	// Operations are visited in a stable order, so collision suffixes are deterministic
+	for _, path := range slices.Sorted(maps.Keys(spec.Paths)) {
+		pathItem := spec.Paths[path]
+		ops := pathItem.getOperations()
+		for _, method := range operationMethods {
+			op := ops[method]
 			if op == nil {
 				continue
 			}
@@ -159,11 +453,22 @@ func ConvertOpenAPIToFunctions(spec *OpenAPISpec) map[string]*FunctionDefinition
 			}
 
 			funcDef := &FunctionDefinition{
-				Name:        sanitizeFunctionName(path, method),
+				Name:        names.name(method, path, op),
 				Description: desc,
+				OperationID: op.OperationID,
 				OapiMethod:  method,
 				OapiPath:    path,
+				Servers:     op.Servers,
+				Security:    op.Security,
+			}
+			if len(funcDef.Servers) == 0 {
+				funcDef.Servers = pathItem.Servers
 			}
+			if funcDef.Security == nil {
+				funcDef.Security = spec.Security
+			}
+
+			conv := newSchemaConverter(spec, options)
 
 			// Build parameters schema
 			params := Schema{
@@ -172,75 +477,226 @@ func ConvertOpenAPIToFunctions(spec *OpenAPISpec) map[string]*FunctionDefinition
 				Required:   []string{},
 			}
 
-			var pathParams, queryParams []string
-
-			// Handle path and query parameters
-			for _, param := range op.Parameters {
-				// Resolve $ref if present
-				resolvedParam := resolveParameterRef(param, spec)
+			var pathParams, queryParams, headerParams, cookieParams []string
+			var boundArgs map[string]any
+			oapiParams := map[string]*Parameter{}
 
-				if resolvedParam.In == "path" || resolvedParam.In == "query" {
-					prop := convertSchemaToProperty(resolvedParam.Schema)
-					prop.Description = resolvedParam.Description
-					params.Properties[resolvedParam.Name] = prop
+			// Path level parameters apply to every operation unless overridden
+			opParams, err := mergeParameters(pathItem.Parameters, op.Parameters, spec)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
 
-					if resolvedParam.Required {
-						params.Required = append(params.Required, resolvedParam.Name)
+			// Handle path, query, header and cookie parameters
+			for _, resolvedParam := range opParams {
+				switch resolvedParam.In {
+				case "path", "query", "cookie":
+				case "header":
+					// Controlled by the client, ignored by the spec
+					if ignoredHeaderParams[http.CanonicalHeaderKey(resolvedParam.Name)] {
+						continue
 					}
+				default:
+					continue
+				}
 
-					if resolvedParam.In == "path" {
-						pathParams = append(pathParams, resolvedParam.Name)
-					} else {
-						queryParams = append(queryParams, resolvedParam.Name)
+				switch resolvedParam.In {
+				case "path":
+					pathParams = append(pathParams, resolvedParam.Name)
+				case "query":
+					queryParams = append(queryParams, resolvedParam.Name)
+				case "header":
+					headerParams = append(headerParams, resolvedParam.Name)
+				case "cookie":
+					cookieParams = append(cookieParams, resolvedParam.Name)
+				}
+				oapiParams[resolvedParam.Name] = &resolvedParam
+
+				// Bound parameters are sent with a fixed value and hidden from the model
+				if value, ok := options.bound[boundParameter{in: resolvedParam.In, name: resolvedParam.Name}]; ok {
+					if boundArgs == nil {
+						boundArgs = map[string]any{}
 					}
+					boundArgs[resolvedParam.Name] = value
+					continue
+				}
+
+				prop, err := conv.convertSchemaToProperty(resolvedParam.Schema)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: parameter %q: %w", method, path, resolvedParam.Name, err)
+				}
+				prop.Description = resolvedParam.Description
+				params.Properties[resolvedParam.Name] = prop
+
+				if resolvedParam.Required {
+					params.Required = append(params.Required, resolvedParam.Name)
 				}
 			}
 
 			// Handle request body
 			if op.RequestBody != nil {
-				for _, mediaType := range op.RequestBody.Content {
-					if mediaType.Schema != nil {
-						reqBodySchema := convertSchemaToProperty(mediaType.Schema)
+				requestBody, err := resolveRequestBodyRef(op.RequestBody, spec)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: %w", method, path, err)
+				}
+				if contentType, ok := selectMediaType(requestBody.Content, options.mediaTypes); ok {
+					mediaType := requestBody.Content[contentType]
+					funcDef.RequestContentType = contentType
+					funcDef.RequestEncoding = mediaType.Encoding
+
+					switch kind := bodyKind(contentType); {
+					case kind == bodyBinary:
+						// Raw content is supplied by the application
+						funcDef.FileParams = []string{"requestBody"}
+					case mediaType.Schema != nil:
+						reqBodySchema, err := conv.convertSchemaToProperty(mediaType.Schema)
+						if err != nil {
+							return nil, fmt.Errorf("%s %s: request body: %w", method, path, err)
+						}
+						if kind == bodyMultipart {
+							funcDef.FileParams = hideFileProperties(reqBodySchema)
+						}
 						params.Properties["requestBody"] = reqBodySchema
 					}
 				}
+				if requestBody.Required && params.Properties["requestBody"] != nil {
+					params.Required = append(params.Required, "requestBody")
+				}
 			}
 
 			funcDef.Parameters = params
 			funcDef.PathParams = pathParams
 			funcDef.QueryParams = queryParams
+			funcDef.HeaderParams = headerParams
+			funcDef.CookieParams = cookieParams
+			funcDef.BoundArgs = boundArgs
+			funcDef.OapiParams = oapiParams
+
+			// Handle responses
+			if len(op.Responses) > 0 {
+				responses, err := convertResponses(op.Responses, spec, conv)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: %w", method, path, err)
+				}
+				funcDef.Responses = responses
+				if options.returnsHint {
+					if hint := funcDef.returnsHint(); hint != "" {
+						funcDef.Description = strings.TrimPrefix(funcDef.Description+"\nreturns: "+hint, "\n")
+					}
+				}
+			}
 
 			functions[funcDef.Name] = funcDef
 		}
 	}
 
-	return functions
+	return functions, nil
+}
+
+// mergeParameters resolves path level and operation level parameters, an operation
+// parameter overrides a path parameter with the same name and location
+func mergeParameters(pathParams, opParams []Parameter, spec *OpenAPISpec) ([]Parameter, error) {
+	merged := make([]Parameter, 0, len(pathParams)+len(opParams))
+	for _, params := range [][]Parameter{pathParams, opParams} {
+		for _, param := range params {
+			// Resolve $ref if present
+			resolvedParam, err := resolveParameterRef(param, spec)
+			if err != nil {
+				return nil, err
+			}
+			merged = slices.DeleteFunc(merged, func(p Parameter) bool {
+				return p.Name == resolvedParam.Name && p.In == resolvedParam.In
+			})
+			merged = append(merged, resolvedParam)
+		}
+	}
+	return merged, nil
 }
 
-// Sanitize function name
-func sanitizeFunctionName(path, method string) string {
-	name := strings.ReplaceAll(path, "/", "_")
-	name = strings.ReplaceAll(name, "{", "")
-	name = strings.ReplaceAll(name, "}", "")
-	name = method + name
-	return strings.ToLower(name)
+// schemaConverter converts spec schemas to function parameter properties,
+// inlining $ref schemas from components.schemas
+type schemaConverter struct {
+	spec    *OpenAPISpec
+	options *convertOptions
+	// visiting holds refs being inlined on the current branch, used for cycle detection
+	visiting map[string]bool
+}
+
+func newSchemaConverter(spec *OpenAPISpec, options *convertOptions) *schemaConverter {
+	return &schemaConverter{
+		spec:     spec,
+		options:  options,
+		visiting: map[string]bool{},
+	}
 }
 
 // Convert OpenAPI schema to function parameter property
-func convertSchemaToProperty(schema *Schema) *Schema {
+func (c *schemaConverter) convertSchemaToProperty(schema *Schema) (*Schema, error) {
 	if schema == nil {
-		return &Schema{Type: "string"}
+		return &Schema{Type: "string"}, nil
+	}
+
+	if schema.Ref != "" {
+		return c.convertRef(schema)
 	}
 
 	prop := &Schema{
 		Type:        schema.Type,
 		Description: schema.Description,
+		Format:      schema.Format,
+		Nullable:    schema.Nullable,
+		Enum:        schema.Enum,
+		Const:       schema.Const,
+		Default:     schema.Default,
+		Example:     schema.Example,
+		Examples:    schema.Examples,
+
+		Minimum:          schema.Minimum,
+		Maximum:          schema.Maximum,
+		ExclusiveMinimum: schema.ExclusiveMinimum,
+		ExclusiveMaximum: schema.ExclusiveMaximum,
+		MultipleOf:       schema.MultipleOf,
+		MinLength:        schema.MinLength,
+		MaxLength:        schema.MaxLength,
+		Pattern:          schema.Pattern,
+		MinItems:         schema.MinItems,
+		MaxItems:         schema.MaxItems,
+		UniqueItems:      schema.UniqueItems,
+	}
+
+	if schema.Type == "array" || schema.Items != nil {
+		if schema.Items != nil {
+			items, err := c.convertSchemaToProperty(schema.Items)
+			if err != nil {
+				return nil, fmt.Errorf("items: %w", err)
+			}
+			prop.Items = items
+		} else {
+			// Function calling rejects arrays without items, an empty schema allows any item
+			prop.Items = &Schema{}
+		}
+	}
+
+	if schema.AdditionalProperties != nil {
+		additional := &AdditionalProperties{Allowed: schema.AdditionalProperties.Allowed}
+		if schema.AdditionalProperties.Schema != nil {
+			sub, err := c.convertSchemaToProperty(schema.AdditionalProperties.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("additionalProperties: %w", err)
+			}
+			additional.Schema = sub
+		}
+		prop.AdditionalProperties = additional
 	}
 
 	if schema.Properties != nil {
 		props := map[string]*Schema{}
 		for name, subSchema := range schema.Properties {
-			props[name] = convertSchemaToProperty(subSchema)
+			subProp, err := c.convertSchemaToProperty(subSchema)
+			if err != nil {
+				return nil, fmt.Errorf("property %q: %w", name, err)
+			}
+			props[name] = subProp
 		}
 		prop.Properties = props
 
@@ -249,7 +705,129 @@ func convertSchemaToProperty(schema *Schema) *Schema {
 		}
 	}
 
-	return prop
+	var err error
+	if prop.AllOf, err = c.convertSchemas("allOf", schema.AllOf); err != nil {
+		return nil, err
+	}
+	if prop.OneOf, err = c.convertSchemas("oneOf", schema.OneOf); err != nil {
+		return nil, err
+	}
+	if prop.AnyOf, err = c.convertSchemas("anyOf", schema.AnyOf); err != nil {
+		return nil, err
+	}
+	if schema.Not != nil {
+		if prop.Not, err = c.convertSchemaToProperty(schema.Not); err != nil {
+			return nil, fmt.Errorf("not: %w", err)
+		}
+	}
+
+	if c.options.flattenAllOf && len(prop.AllOf) > 0 {
+		prop = mergeAllOf(prop)
+	}
+
+	return prop, nil
+}
+
+// convertSchemas converts the subschemas of a composition keyword
+func (c *schemaConverter) convertSchemas(keyword string, schemas []*Schema) ([]*Schema, error) {
+	if len(schemas) == 0 {
+		return nil, nil
+	}
+	props := make([]*Schema, 0, len(schemas))
+	for i, subSchema := range schemas {
+		subProp, err := c.convertSchemaToProperty(subSchema)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: %w", keyword, i, err)
+		}
+		props = append(props, subProp)
+	}
+	return props, nil
+}
+
+// mergeAllOf merges the already converted allOf subschemas of prop into prop itself.
+// Properties and required lists are united, keywords of prop take precedence.
+func mergeAllOf(prop *Schema) *Schema {
+	merged := *prop
+	merged.AllOf = nil
+	merged.Required = slices.Clone(prop.Required)
+
+	for _, sub := range prop.AllOf {
+		if merged.Type == "" {
+			merged.Type = sub.Type
+		}
+		if merged.Format == "" {
+			merged.Format = sub.Format
+		}
+		if merged.Description == "" {
+			merged.Description = sub.Description
+		}
+		if merged.Items == nil {
+			merged.Items = sub.Items
+		}
+		if merged.Enum == nil {
+			merged.Enum = sub.Enum
+		}
+
+		if len(sub.Properties) > 0 {
+			props := make(map[string]*Schema, len(merged.Properties)+len(sub.Properties))
+			for name, p := range sub.Properties {
+				props[name] = p
+			}
+			// Own properties override inherited ones
+			for name, p := range merged.Properties {
+				props[name] = p
+			}
+			merged.Properties = props
+		}
+
+		for _, name := range sub.Required {
+			if !slices.Contains(merged.Required, name) {
+				merged.Required = append(merged.Required, name)
+			}
+		}
+
+		merged.OneOf = append(merged.OneOf, sub.OneOf...)
+		merged.AnyOf = append(merged.AnyOf, sub.AnyOf...)
+		if merged.Not == nil {
+			merged.Not = sub.Not
+		}
+	}
+
+	return &merged
+}
+
+// convertRef inlines the schema referenced by schema.Ref.
+// Recursive references can not be inlined, so the cycle is cut with a plain object.
+func (c *schemaConverter) convertRef(schema *Schema) (*Schema, error) {
+	target, err := resolveSchemaRef(schema.Ref, c.spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.visiting[schema.Ref] {
+		return &Schema{Type: "object", Description: firstNonEmpty(schema.Description, target.Description)}, nil
+	}
+
+	c.visiting[schema.Ref] = true
+	prop, err := c.convertSchemaToProperty(target)
+	delete(c.visiting, schema.Ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if schema.Description != "" {
+		prop.Description = schema.Description
+	}
+	return prop, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
 
 // UnmarshalOpenAPISpecFromJSON unmarshals OpenAPI spec from JSON data
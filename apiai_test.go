@@ -37,7 +37,10 @@ func TestResolveParameterRef(t *testing.T) {
 		Ref: "#/components/parameters/offsetParam",
 	}
 
-	resolved := resolveParameterRef(paramWithRef, spec)
+	resolved, err := resolveParameterRef(paramWithRef, spec)
+	if err != nil {
+		t.Fatalf("Failed to resolve parameter: %v", err)
+	}
 	if resolved.Name != "offset" {
 		t.Errorf("Expected parameter name 'offset', got '%s'", resolved.Name)
 	}
@@ -53,10 +56,9 @@ func TestResolveParameterRef(t *testing.T) {
 		Ref: "#/components/parameters/nonExistentParam",
 	}
 
-	resolvedInvalid := resolveParameterRef(paramWithInvalidRef, spec)
-	// Should return the original parameter when ref is not found
-	if resolvedInvalid.Ref != "#/components/parameters/nonExistentParam" {
-		t.Errorf("Expected original parameter to be returned for invalid ref")
+	// Should return an error when ref is not found
+	if _, err := resolveParameterRef(paramWithInvalidRef, spec); err == nil {
+		t.Errorf("Expected error for unresolved ref")
 	}
 
 	// Test parameter without $ref
@@ -65,7 +67,10 @@ func TestResolveParameterRef(t *testing.T) {
 		In:   "query",
 	}
 
-	resolvedDirect := resolveParameterRef(paramWithoutRef, spec)
+	resolvedDirect, err := resolveParameterRef(paramWithoutRef, spec)
+	if err != nil {
+		t.Fatalf("Failed to resolve parameter: %v", err)
+	}
 	if resolvedDirect.Name != "directParam" {
 		t.Errorf("Expected parameter name 'directParam', got '%s'", resolvedDirect.Name)
 	}
@@ -143,7 +148,10 @@ func TestConvertOpenAPIToFunctionsWithRefs(t *testing.T) {
 		t.Fatalf("Failed to unmarshal test spec: %v", err)
 	}
 
-	functions := ConvertOpenAPIToFunctions(&spec)
+	functions, err := ConvertOpenAPIToFunctions(&spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
 
 	// Check that we have the expected functions
 	if len(functions) != 2 {
@@ -259,7 +267,10 @@ paths:
 	}
 
 	// Test conversion to functions
-	functions := ConvertOpenAPIToFunctions(spec)
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
 	if len(functions) != 1 {
 		t.Errorf("Expected 1 function, got %d", len(functions))
 	}
@@ -323,3 +334,384 @@ paths:
 		t.Errorf("Expected title 'YAML Test API', got '%s'", spec.Info.Title)
 	}
 }
+
+func TestConvertOpenAPIToFunctionsWithSchemaRefs(t *testing.T) {
+	specJSON := `{
+		"openapi": "3.0.0",
+		"info": {"title": "Pets", "version": "1.0.0"},
+		"components": {
+			"schemas": {
+				"Pet": {
+					"type": "object",
+					"description": "A pet",
+					"properties": {
+						"name": {"type": "string"},
+						"owner": {"$ref": "#/components/schemas/Owner"},
+						"parent": {"$ref": "#/components/schemas/Pet"}
+					},
+					"required": ["name"]
+				},
+				"Owner": {
+					"type": "object",
+					"properties": {
+						"email": {"type": "string", "format": "email"}
+					}
+				}
+			}
+		},
+		"paths": {
+			"/pets": {
+				"post": {
+					"summary": "Create a pet",
+					"requestBody": {
+						"content": {
+							"application/json": {
+								"schema": {"$ref": "#/components/schemas/Pet"}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	var spec OpenAPISpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to unmarshal test spec: %v", err)
+	}
+
+	functions, err := ConvertOpenAPIToFunctions(&spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	fn, exists := functions["post_pets"]
+	if !exists {
+		t.Fatalf("Expected post_pets function to exist")
+	}
+
+	body := fn.Parameters.Properties["requestBody"]
+	if body == nil {
+		t.Fatalf("Expected requestBody property to exist")
+	}
+	if body.Ref != "" {
+		t.Errorf("Expected $ref to be inlined, got '%s'", body.Ref)
+	}
+	if body.Type != "object" || body.Description != "A pet" {
+		t.Errorf("Expected inlined Pet object, got %+v", body)
+	}
+	if len(body.Required) != 1 || body.Required[0] != "name" {
+		t.Errorf("Expected required [name], got %v", body.Required)
+	}
+
+	owner := body.Properties["owner"]
+	if owner == nil || owner.Properties["email"] == nil || owner.Properties["email"].Type != "string" {
+		t.Errorf("Expected nested Owner schema to be inlined, got %+v", owner)
+	}
+
+	// The recursive reference is cut instead of being expanded forever
+	parent := body.Properties["parent"]
+	if parent == nil || parent.Type != "object" || parent.Properties != nil {
+		t.Errorf("Expected recursive Pet reference to be a plain object, got %+v", parent)
+	}
+}
+
+func TestConvertOpenAPIToFunctionsComposition(t *testing.T) {
+	specJSON := `{
+		"openapi": "3.0.0",
+		"info": {"title": "Pets", "version": "1.0.0"},
+		"components": {
+			"schemas": {
+				"NewPet": {
+					"type": "object",
+					"properties": {
+						"name": {"type": "string"},
+						"tag": {"type": "string"}
+					},
+					"required": ["name"]
+				},
+				"Pet": {
+					"allOf": [
+						{"$ref": "#/components/schemas/NewPet"},
+						{
+							"type": "object",
+							"properties": {"id": {"type": "integer", "format": "int64"}},
+							"required": ["id"]
+						}
+					]
+				},
+				"Cat": {"type": "object", "properties": {"hunts": {"type": "boolean"}}},
+				"Dog": {"type": "object", "properties": {"bark": {"type": "boolean"}}}
+			}
+		},
+		"paths": {
+			"/pets": {
+				"put": {
+					"summary": "Replace a pet",
+					"requestBody": {
+						"content": {
+							"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}
+						}
+					}
+				},
+				"post": {
+					"summary": "Add a cat or a dog",
+					"requestBody": {
+						"content": {
+							"application/json": {
+								"schema": {
+									"oneOf": [
+										{"$ref": "#/components/schemas/Cat"},
+										{"$ref": "#/components/schemas/Dog"}
+									],
+									"not": {"type": "string"}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	spec, err := UnmarshalOpenAPISpecFromJSON([]byte(specJSON))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal test spec: %v", err)
+	}
+
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	pet := functions["put_pets"].Parameters.Properties["requestBody"]
+	if len(pet.AllOf) != 2 {
+		t.Fatalf("Expected allOf with 2 schemas, got %+v", pet)
+	}
+	if pet.AllOf[0].Properties["name"] == nil || pet.AllOf[1].Properties["id"] == nil {
+		t.Errorf("Expected allOf subschemas to be converted, got %+v", pet.AllOf)
+	}
+
+	animal := functions["post_pets"].Parameters.Properties["requestBody"]
+	if len(animal.OneOf) != 2 || animal.OneOf[1].Properties["bark"] == nil {
+		t.Errorf("Expected oneOf subschemas to be converted, got %+v", animal.OneOf)
+	}
+	if animal.Not == nil || animal.Not.Type != "string" {
+		t.Errorf("Expected not schema to be converted, got %+v", animal.Not)
+	}
+
+	// Flattened allOf
+	functions, err = ConvertOpenAPIToFunctions(spec, WithFlattenAllOf())
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	pet = functions["put_pets"].Parameters.Properties["requestBody"]
+	if len(pet.AllOf) != 0 {
+		t.Errorf("Expected allOf to be merged, got %+v", pet.AllOf)
+	}
+	if pet.Type != "object" || len(pet.Properties) != 3 {
+		t.Errorf("Expected flat object with 3 properties, got %+v", pet)
+	}
+	if len(pet.Required) != 2 || pet.Required[0] != "name" || pet.Required[1] != "id" {
+		t.Errorf("Expected required [name id], got %v", pet.Required)
+	}
+	if len(spec.Components.Schemas["NewPet"].Required) != 1 {
+		t.Errorf("Expected spec schemas to stay unchanged")
+	}
+}
+
+func TestConvertOpenAPIToFunctionsValidationKeywords(t *testing.T) {
+	specYAML := `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      summary: Find pets
+      parameters:
+        - name: status
+          in: query
+          schema:
+            type: array
+            items:
+              type: string
+              enum: [available, pending, sold]
+              default: available
+            minItems: 1
+            maxItems: 3
+            uniqueItems: true
+        - name: tags
+          in: query
+          schema:
+            type: array
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 100
+            exclusiveMaximum: true
+            default: 0
+        - name: name
+          in: query
+          schema:
+            type: string
+            minLength: 2
+            maxLength: 20
+            pattern: '^[a-z]+$'
+        - name: labels
+          in: query
+          schema:
+            type: object
+            additionalProperties:
+              type: string
+        - name: strict
+          in: query
+          schema:
+            type: object
+            additionalProperties: false
+`
+
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(specYAML))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	params, err := functions["get_pets"].ToolParameters()
+	if err != nil {
+		t.Fatalf("Failed to get tool parameters: %v", err)
+	}
+	got := params["properties"].(map[string]any)
+
+	want := map[string]any{
+		"status": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type":    "string",
+				"enum":    []any{"available", "pending", "sold"},
+				"default": "available",
+			},
+			"minItems":    float64(1),
+			"maxItems":    float64(3),
+			"uniqueItems": true,
+		},
+		"tags": map[string]any{
+			"type":  "array",
+			"items": map[string]any{},
+		},
+		"limit": map[string]any{
+			"type":             "integer",
+			"minimum":          float64(1),
+			"exclusiveMaximum": float64(100),
+			"default":          float64(0),
+		},
+		"name": map[string]any{
+			"type":      "string",
+			"minLength": float64(2),
+			"maxLength": float64(20),
+			"pattern":   "^[a-z]+$",
+		},
+		"labels": map[string]any{
+			"type":                 "object",
+			"additionalProperties": map[string]any{"type": "string"},
+		},
+		"strict": map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+		},
+	}
+
+	for name, w := range want {
+		wantJSON, _ := json.Marshal(w)
+		gotJSON, _ := json.Marshal(got[name])
+		if string(wantJSON) != string(gotJSON) {
+			t.Errorf("Parameter %s:\n got  %s\n want %s", name, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestConvertOpenAPIToFunctionsPathLevelParameters(t *testing.T) {
+	specYAML := `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+components:
+  parameters:
+    PetID:
+      name: id
+      in: path
+      required: true
+      description: Pet identifier
+      schema:
+        type: integer
+paths:
+  /pets/{id}:
+    parameters:
+      - $ref: '#/components/parameters/PetID'
+      - name: verbose
+        in: query
+        schema:
+          type: boolean
+    get:
+      summary: Get a pet
+    delete:
+      summary: Delete a pet
+      parameters:
+        - name: id
+          in: path
+          required: true
+          description: Pet to delete
+          schema:
+            type: string
+    head:
+      summary: Check a pet
+    options:
+      summary: Pet options
+    trace:
+      summary: Trace a pet
+`
+
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(specYAML))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	for _, name := range []string{"get_pets_id", "delete_pets_id", "head_pets_id", "options_pets_id", "trace_pets_id"} {
+		fn, exists := functions[name]
+		if !exists {
+			t.Errorf("Expected %s function to exist", name)
+			continue
+		}
+		if len(fn.PathParams) != 1 || fn.PathParams[0] != "id" {
+			t.Errorf("%s: expected path parameter id, got %v", name, fn.PathParams)
+		}
+		if len(fn.QueryParams) != 1 || fn.QueryParams[0] != "verbose" {
+			t.Errorf("%s: expected query parameter verbose, got %v", name, fn.QueryParams)
+		}
+		if len(fn.Parameters.Required) != 1 || fn.Parameters.Required[0] != "id" {
+			t.Errorf("%s: expected id to be required, got %v", name, fn.Parameters.Required)
+		}
+	}
+
+	if id := functions["get_pets_id"].Parameters.Properties["id"]; id.Type != "integer" || id.Description != "Pet identifier" {
+		t.Errorf("Expected path level id parameter, got %+v", id)
+	}
+	// The operation parameter overrides the path level one
+	if id := functions["delete_pets_id"].Parameters.Properties["id"]; id.Type != "string" || id.Description != "Pet to delete" {
+		t.Errorf("Expected overridden id parameter, got %+v", id)
+	}
+}
@@ -0,0 +1,385 @@
+package apiai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// DefaultMediaTypePreference is the order request body media types are picked in
+var DefaultMediaTypePreference = []string{
+	"application/json",
+	"application/*+json",
+	"application/x-www-form-urlencoded",
+	"multipart/form-data",
+	"text/plain",
+	"application/octet-stream",
+}
+
+// WithMediaTypePreference sets the order request body media types are picked in,
+// patterns like "application/*+json", "text/*" and "*/*" are allowed. Media types not
+// matching any pattern are picked in alphabetical order.
+func WithMediaTypePreference(mediaTypes ...string) ConvertOption {
+	return func(o *convertOptions) {
+		o.mediaTypes = mediaTypes
+	}
+}
+
+// FilePart is a file sent in a multipart/form-data or binary request body.
+// Files are supplied by the application as arguments named after
+// FunctionDefinition.FileParams, they are never exposed to the model.
+type FilePart struct {
+	Filename    string
+	ContentType string
+	Content     io.Reader
+}
+
+// selectMediaType picks a media type of the request body content by preference
+func selectMediaType(content map[string]MediaType, preference []string) (string, bool) {
+	if len(content) == 0 {
+		return "", false
+	}
+	if preference == nil {
+		preference = DefaultMediaTypePreference
+	}
+
+	mediaTypes := slices.Sorted(maps.Keys(content))
+	for _, pattern := range preference {
+		for _, mediaType := range mediaTypes {
+			if mediaTypeMatches(mediaType, pattern) {
+				return mediaType, true
+			}
+		}
+	}
+	return mediaTypes[0], true
+}
+
+// mediaTypeMatches reports whether the media type matches the pattern,
+// parameters of the media type are ignored
+func mediaTypeMatches(mediaType, pattern string) bool {
+	base := baseMediaType(mediaType)
+	pattern = strings.ToLower(pattern)
+	if pattern == "*/*" || base == pattern {
+		return true
+	}
+
+	typ, sub, _ := strings.Cut(base, "/")
+	ptyp, psub, _ := strings.Cut(pattern, "/")
+	if typ != ptyp {
+		return false
+	}
+	if psub == "*" {
+		return true
+	}
+	// Structured syntax suffix, e.g. application/*+json
+	if suffix, ok := strings.CutPrefix(psub, "*"); ok {
+		return strings.HasSuffix(sub, suffix)
+	}
+	return false
+}
+
+func baseMediaType(mediaType string) string {
+	base, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		base, _, _ = strings.Cut(mediaType, ";")
+	}
+	return strings.ToLower(strings.TrimSpace(base))
+}
+
+// body kinds by media type
+const (
+	bodyJSON = iota
+	bodyForm
+	bodyMultipart
+	bodyText
+	bodyBinary
+)
+
+func bodyKind(mediaType string) int {
+	base := baseMediaType(mediaType)
+	switch {
+	case base == "" || base == "application/json" || strings.HasSuffix(base, "+json"):
+		return bodyJSON
+	case base == "application/x-www-form-urlencoded":
+		return bodyForm
+	case strings.HasPrefix(base, "multipart/"):
+		return bodyMultipart
+	case strings.HasPrefix(base, "text/"):
+		return bodyText
+	default:
+		return bodyBinary
+	}
+}
+
+// isBinarySchema reports whether the schema describes file content
+func isBinarySchema(schema *Schema) bool {
+	if schema == nil {
+		return false
+	}
+	if schema.Type == "array" {
+		return isBinarySchema(schema.Items)
+	}
+	return schema.Type == "string" && schema.Format == "binary"
+}
+
+// hideFileProperties removes binary properties of a multipart body from the schema
+// and returns their names
+func hideFileProperties(schema *Schema) []string {
+	var files []string
+	for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+		if isBinarySchema(schema.Properties[name]) {
+			files = append(files, name)
+			delete(schema.Properties, name)
+		}
+	}
+	if len(files) > 0 && len(schema.Required) > 0 {
+		schema.Required = slices.DeleteFunc(slices.Clone(schema.Required), func(name string) bool {
+			return slices.Contains(files, name)
+		})
+	}
+	return files
+}
+
+// encodeRequestBody encodes the request body with the media type of the function,
+// file parts are taken from the arguments
+func encodeRequestBody(fn *FunctionDefinition, requestBody any, args map[string]any) (io.Reader, string, error) {
+	contentType := fn.RequestContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	switch bodyKind(contentType) {
+	case bodyJSON:
+		if requestBody == nil {
+			return nil, "", nil
+		}
+		data, err := json.Marshal(requestBody)
+		if err != nil {
+			return nil, "", err
+		}
+		return bytes.NewReader(data), contentType, nil
+
+	case bodyForm:
+		if requestBody == nil {
+			return nil, "", nil
+		}
+		data, err := encodeFormBody(requestBody, fn.RequestEncoding)
+		if err != nil {
+			return nil, "", err
+		}
+		return strings.NewReader(data), contentType, nil
+
+	case bodyMultipart:
+		return encodeMultipartBody(fn, requestBody, args)
+
+	case bodyText:
+		if requestBody == nil {
+			return nil, "", nil
+		}
+		if r, ok := requestBody.(io.Reader); ok {
+			return r, contentType, nil
+		}
+		text, err := formatScalar(requestBody)
+		if err != nil {
+			return nil, "", fmt.Errorf("request body: %w", err)
+		}
+		return strings.NewReader(text), contentType, nil
+
+	default:
+		switch body := requestBody.(type) {
+		case nil:
+			return nil, "", nil
+		case FilePart:
+			return body.Content, firstNonEmpty(body.ContentType, contentType), nil
+		case *FilePart:
+			return body.Content, firstNonEmpty(body.ContentType, contentType), nil
+		case []byte:
+			return bytes.NewReader(body), contentType, nil
+		case io.Reader:
+			return body, contentType, nil
+		default:
+			return nil, "", fmt.Errorf("request body of type %s must be supplied by the application as a FilePart", contentType)
+		}
+	}
+}
+
+// encodeFormBody encodes object properties as application/x-www-form-urlencoded.
+// Properties are serialized like form query parameters unless the encoding sets
+// a JSON content type, objects without an explicit style are sent as JSON.
+func encodeFormBody(requestBody any, encoding map[string]Encoding) (string, error) {
+	fields, ok := requestBody.(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("form request body must be an object, got %T", requestBody)
+	}
+
+	var pairs []string
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		value := fields[name]
+		if value == nil {
+			continue
+		}
+		enc := encoding[name]
+
+		isJSON := enc.ContentType != "" && bodyKind(enc.ContentType) == bodyJSON
+		if isJSON || enc.ContentType == "" && enc.Style == "" && isNested(value) {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, escapeQueryValue(name, false)+"="+escapeQueryValue(string(data), enc.AllowReserved))
+			continue
+		}
+
+		p := &Parameter{Name: name, In: "query", Style: enc.Style, Explode: enc.Explode, AllowReserved: enc.AllowReserved}
+		fieldPairs, err := serializeQueryParam(p, value)
+		if err != nil {
+			return "", err
+		}
+		pairs = append(pairs, fieldPairs...)
+	}
+	return strings.Join(pairs, "&"), nil
+}
+
+// isNested reports whether the value is an object or an array of objects and arrays
+func isNested(value any) bool {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Map, reflect.Struct:
+		return true
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			switch reflect.ValueOf(v.Index(i).Interface()).Kind() {
+			case reflect.Map, reflect.Struct, reflect.Slice, reflect.Array:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encodeMultipartBody writes object properties as form fields, objects as JSON parts
+// and the application supplied file parts
+func encodeMultipartBody(fn *FunctionDefinition, requestBody any, args map[string]any) (io.Reader, string, error) {
+	fields, ok := requestBody.(map[string]any)
+	if !ok && requestBody != nil {
+		return nil, "", fmt.Errorf("multipart request body must be an object, got %T", requestBody)
+	}
+	if requestBody == nil && !slices.ContainsFunc(fn.FileParams, func(name string) bool { return args[name] != nil }) {
+		return nil, "", nil
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		value := fields[name]
+		if value == nil || slices.Contains(fn.FileParams, name) {
+			continue
+		}
+		enc := fn.RequestEncoding[name]
+
+		values := []any{value}
+		if v := reflect.ValueOf(value); (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && !isNested(value) && enc.ContentType == "" {
+			// Arrays of primitives are sent as repeated fields
+			values = values[:0]
+			for i := 0; i < v.Len(); i++ {
+				values = append(values, v.Index(i).Interface())
+			}
+		}
+
+		for _, value := range values {
+			contentType := enc.ContentType
+			if contentType == "" && isNested(value) {
+				contentType = "application/json"
+			}
+
+			var data []byte
+			if bodyKind(contentType) == bodyJSON && contentType != "" {
+				var err error
+				if data, err = json.Marshal(value); err != nil {
+					return nil, "", err
+				}
+			} else {
+				text, err := formatScalar(value)
+				if err != nil {
+					return nil, "", fmt.Errorf("property %q: %w", name, err)
+				}
+				data = []byte(text)
+			}
+
+			h := textproto.MIMEHeader{}
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(name)))
+			if contentType != "" {
+				h.Set("Content-Type", contentType)
+			}
+			part, err := w.CreatePart(h)
+			if err != nil {
+				return nil, "", err
+			}
+			if _, err := part.Write(data); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	for _, name := range fn.FileParams {
+		value, ok := args[name]
+		if !ok || value == nil {
+			continue
+		}
+
+		var files []any
+		if v := reflect.ValueOf(value); v.Kind() == reflect.Slice {
+			for i := 0; i < v.Len(); i++ {
+				files = append(files, v.Index(i).Interface())
+			}
+		} else {
+			files = []any{value}
+		}
+
+		for _, file := range files {
+			var fp FilePart
+			switch f := file.(type) {
+			case FilePart:
+				fp = f
+			case *FilePart:
+				fp = *f
+			default:
+				return nil, "", fmt.Errorf("file %q must be supplied by the application as a FilePart, got %T", name, file)
+			}
+
+			contentType := firstNonEmpty(fp.ContentType, fn.RequestEncoding[name].ContentType, "application/octet-stream")
+			h := textproto.MIMEHeader{}
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(name), escapeQuotes(fp.Filename)))
+			h.Set("Content-Type", contentType)
+			part, err := w.CreatePart(h)
+			if err != nil {
+				return nil, "", err
+			}
+			if fp.Content != nil {
+				if _, err := io.Copy(part, fp.Content); err != nil {
+					return nil, "", fmt.Errorf("file %q: %w", name, err)
+				}
+			}
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, w.FormDataContentType(), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
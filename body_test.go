@@ -0,0 +1,280 @@
+package apiai
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSelectMediaType(t *testing.T) {
+	tests := []struct {
+		content    []string
+		preference []string
+		want       string
+	}{
+		{[]string{"application/xml", "application/json", "text/plain"}, nil, "application/json"},
+		{[]string{"application/xml", "application/merge-patch+json"}, nil, "application/merge-patch+json"},
+		{[]string{"multipart/form-data", "application/x-www-form-urlencoded"}, nil, "application/x-www-form-urlencoded"},
+		{[]string{"application/json; charset=utf-8", "text/plain"}, nil, "application/json; charset=utf-8"},
+		{[]string{"image/png", "application/xml"}, nil, "application/xml"},
+		{[]string{"application/json", "multipart/form-data"}, []string{"multipart/*"}, "multipart/form-data"},
+		{[]string{"application/json", "text/csv"}, []string{"text/*", "*/*"}, "text/csv"},
+	}
+	for _, tt := range tests {
+		content := map[string]MediaType{}
+		for _, mediaType := range tt.content {
+			content[mediaType] = MediaType{}
+		}
+		// Map order must not matter
+		for range 10 {
+			if got, _ := selectMediaType(content, tt.preference); got != tt.want {
+				t.Errorf("%v %v: expected %q, got %q", tt.content, tt.preference, tt.want, got)
+				break
+			}
+		}
+	}
+}
+
+const uploadSpec = `
+openapi: 3.0.0
+info:
+  title: Uploads
+  version: 1.0.0
+paths:
+  /pets:
+    post:
+      operationId: createPet
+      requestBody:
+        required: true
+        content:
+          application/xml:
+            schema:
+              type: object
+          application/x-www-form-urlencoded:
+            schema:
+              type: object
+              properties:
+                name:
+                  type: string
+                tags:
+                  type: array
+                  items:
+                    type: string
+                owner:
+                  type: object
+            encoding:
+              tags:
+                style: pipeDelimited
+                explode: false
+  /pets/{id}/photo:
+    post:
+      operationId: uploadPhoto
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      requestBody:
+        content:
+          multipart/form-data:
+            schema:
+              type: object
+              required: [caption, photo]
+              properties:
+                caption:
+                  type: string
+                labels:
+                  type: array
+                  items:
+                    type: string
+                meta:
+                  type: object
+                photo:
+                  type: string
+                  format: binary
+            encoding:
+              photo:
+                contentType: image/png
+  /pets/{id}/avatar:
+    put:
+      operationId: putAvatar
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      requestBody:
+        content:
+          application/octet-stream: {}
+  /pets/{id}/notes:
+    put:
+      operationId: putNotes
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      requestBody:
+        content:
+          text/plain:
+            schema:
+              type: string
+`
+
+func TestRequestBodyMediaTypes(t *testing.T) {
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(uploadSpec))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	create := functions["createPet"]
+	if create.RequestContentType != "application/x-www-form-urlencoded" {
+		t.Errorf("Expected form media type to be preferred over XML, got %q", create.RequestContentType)
+	}
+
+	upload := functions["uploadPhoto"]
+	body := upload.Parameters.Properties["requestBody"]
+	if _, ok := body.Properties["photo"]; ok || len(upload.FileParams) != 1 || upload.FileParams[0] != "photo" {
+		t.Errorf("Expected photo to be a file parameter hidden from the model, got %v", upload.FileParams)
+	}
+	if len(body.Required) != 1 || body.Required[0] != "caption" {
+		t.Errorf("Expected only caption to be required, got %v", body.Required)
+	}
+	if spec.Paths["/pets/{id}/photo"].Post.RequestBody.Content["multipart/form-data"].Schema.Properties["photo"] == nil {
+		t.Errorf("Expected the spec schema to be left untouched")
+	}
+
+	avatar := functions["putAvatar"]
+	if _, ok := avatar.Parameters.Properties["requestBody"]; ok || len(avatar.FileParams) != 1 {
+		t.Errorf("Expected binary body to be supplied by the application, got %v", avatar.FileParams)
+	}
+
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	// Form
+	_, err = ExecuteFunction(client, create, map[string]any{
+		"requestBody": map[string]any{
+			"name":  "Rex Jr",
+			"tags":  []any{"a", "b"},
+			"owner": map[string]any{"id": float64(1)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to execute form request: %v", err)
+	}
+	if ct := got.Header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+		t.Errorf("Unexpected form content type %q", ct)
+	}
+	if string(gotBody) != "name=Rex%20Jr&owner=%7B%22id%22%3A1%7D&tags=a|b" {
+		t.Errorf("Unexpected form body %q", gotBody)
+	}
+
+	// Multipart with a file supplied by the application
+	_, err = ExecuteFunction(client, upload, map[string]any{
+		"id": "1",
+		"requestBody": map[string]any{
+			"caption": "Rex",
+			"labels":  []any{"dog", "cute"},
+			"meta":    map[string]any{"w": float64(2)},
+		},
+		"photo": FilePart{Filename: "rex.png", Content: strings.NewReader("PNG")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to execute multipart request: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(got.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		t.Fatalf("Unexpected multipart content type %q", got.Header.Get("Content-Type"))
+	}
+	type part struct{ name, filename, contentType, data string }
+	var parts []part
+	mr := multipart.NewReader(strings.NewReader(string(gotBody)), params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := io.ReadAll(p)
+		parts = append(parts, part{p.FormName(), p.FileName(), p.Header.Get("Content-Type"), string(data)})
+	}
+	want := []part{
+		{"caption", "", "", "Rex"},
+		{"labels", "", "", "dog"},
+		{"labels", "", "", "cute"},
+		{"meta", "", "application/json", `{"w":2}`},
+		{"photo", "rex.png", "image/png", "PNG"},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("Expected %d parts, got %+v", len(want), parts)
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Errorf("Part %d: expected %+v, got %+v", i, want[i], parts[i])
+		}
+	}
+
+	// The model can not supply a file
+	_, err = ExecuteFunction(client, upload, map[string]any{
+		"id":          "1",
+		"requestBody": map[string]any{"caption": "Rex"},
+		"photo":       "/etc/passwd",
+	})
+	if err == nil {
+		t.Errorf("Expected an error for a file not supplied as FilePart")
+	}
+
+	// Raw binary
+	_, err = ExecuteFunction(client, avatar, map[string]any{
+		"id":          "1",
+		"requestBody": FilePart{ContentType: "image/jpeg", Content: strings.NewReader("JPEG")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to execute binary request: %v", err)
+	}
+	if got.Header.Get("Content-Type") != "image/jpeg" || string(gotBody) != "JPEG" {
+		t.Errorf("Unexpected binary request %q %q", got.Header.Get("Content-Type"), gotBody)
+	}
+
+	// Plain text
+	_, err = ExecuteFunction(client, functions["putNotes"], map[string]any{"id": "1", "requestBody": "good boy"})
+	if err != nil {
+		t.Fatalf("Failed to execute text request: %v", err)
+	}
+	if got.Header.Get("Content-Type") != "text/plain" || string(gotBody) != "good boy" {
+		t.Errorf("Unexpected text request %q %q", got.Header.Get("Content-Type"), gotBody)
+	}
+
+	// JSON stays the default for definitions without a media type
+	fn := &FunctionDefinition{Name: "raw", OapiMethod: http.MethodPost, OapiPath: "/raw"}
+	if _, err := ExecuteFunction(client, fn, map[string]any{"requestBody": map[string]any{"a": 1}}); err != nil {
+		t.Fatalf("Failed to execute JSON request: %v", err)
+	}
+	var decoded map[string]any
+	if got.Header.Get("Content-Type") != "application/json" || json.Unmarshal(gotBody, &decoded) != nil {
+		t.Errorf("Unexpected JSON request %q %q", got.Header.Get("Content-Type"), gotBody)
+	}
+}
@@ -1,10 +1,15 @@
 package apiai
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
 
 	"golang.org/x/oauth2"
 )
@@ -17,21 +22,25 @@ const (
 	AuthTypeBasic                 = "basic"
 	AuthTypeAPIKeyHeader          = "apikey-header"
 	AuthTypeAPIKeyCookie          = "apikey-cookie"
+	AuthTypeAPIKeyQuery           = "apikey-query"
 	AuthTypeBearer                = "bearer"
 	AuthTypeOAuth2                = "oauth2"
 	AuthTypeCookie                = "cookie"
+	AuthTypeHMAC                  = "hmac"
+	AuthTypeAWSSigV4              = "aws-sigv4"
+	AuthTypeDigest                = "digest"
 )
 
 // AuthConfig contains the authentication configuration.
 type AuthConfig struct {
 	Type AuthType
 
-	// Basic Auth
+	// Basic and Digest Auth
 	Username string
 	Password string
 
 	// API Key
-	APIKeyName  string // name of header or cookie
+	APIKeyName  string // name of header, cookie or query parameter
 	APIKeyValue string
 
 	// Bearer / OAuth2 / OpenID
@@ -40,72 +49,287 @@ type AuthConfig struct {
 	// OAuth2 TokenSource (allows automatic token refresh)
 	TokenSource oauth2.TokenSource
 
+	// OAuth2 client of the spec flows, used with a CredentialRegistry
+	// when neither Token nor TokenSource is set
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+
 	// Cookie Auth: list of cookies (name=value)
 	Cookies []*http.Cookie
+
+	// Request signing (HMAC, AWS SigV4): key ID and secret, SigV4 also needs
+	// the region and service, and the session token of temporary credentials
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	Service         string
+
+	// Reauthenticate renews the credentials after the API answered 401,
+	// e.g. by logging in again for new cookies or a new token. The returned
+	// config replaces the rejected one in the client or registry and the
+	// request is replayed once with it, nil keeps the response as is.
+	// Token sources implementing TokenInvalidator are renewed without it.
+	Reauthenticate func(ctx context.Context, rejected *AuthConfig) (*AuthConfig, error)
+
+	// registered is the registry credential a scoped copy was made from,
+	// for the scopes of the operation
+	registered *AuthConfig
+	scopes     []string
 }
 
 // AuthRoundTripper wraps http.RoundTripper and adds authentication.
 type AuthRoundTripper struct {
-	transport http.RoundTripper
-	config    *AuthConfig
+	transport   http.RoundTripper
+	credentials *CredentialRegistry
+	provider    CredentialProvider
+
+	mu      sync.RWMutex
+	config  *AuthConfig                 // replaced when renewed, see AuthConfig.Reauthenticate
+	digests map[string]*digestChallenge // by host and user
+
+	// replayMutating replays POST and PATCH requests after reauthentication
+	replayMutating bool
 }
 
 // RoundTrip implements the RoundTripper interface.
 func (art *AuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	if art.config == nil || art.config.Type == AuthTypeNone {
+	configs, err := art.authConfigs(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
 		return art.transport.RoundTrip(req)
 	}
 
-	req = req.Clone(req.Context())
+	resp, err := art.send(req, configs)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		var answered bool
+		resp, answered, err = art.answerDigest(req, resp, configs)
+		if err == nil && !answered && resp.StatusCode == http.StatusUnauthorized {
+			resp, err = art.reauthenticate(req, resp, configs)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Query API keys stay inside the round trip: the response refers to
+	// the request without them and redirects are followed without them
+	resp.Request = req
+	redactLocation(resp, configs)
+	return resp, nil
+}
+
+// send applies the credentials to a copy of the request and sends it,
+// the response refers to the authenticated copy
+func (art *AuthRoundTripper) send(req *http.Request, configs []*AuthConfig) (*http.Response, error) {
+	ctx := req.Context()
+	if ctx.Value(oauth2.HTTPClient) == nil && slices.ContainsFunc(configs, func(config *AuthConfig) bool {
+		return config.Type == AuthTypeOAuth2
+	}) {
+		// Token requests of the flows go through the client transport
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: art.transport})
+	}
+	req = req.Clone(ctx)
+	// Digest responses and signatures cover the credentials added by the other schemes
+	for _, last := range []bool{false, true} {
+		for _, config := range configs {
+			if (isSigningAuth(config.Type) || config.Type == AuthTypeDigest) != last {
+				continue
+			}
+			if config.Type == AuthTypeDigest {
+				art.authorizeDigest(req, config)
+				continue
+			}
+			if err := applyAuth(req, config); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resp, err := art.transport.RoundTrip(req)
+	if err != nil {
+		return nil, redactSecrets(err, configs)
+	}
+	return resp, nil
+}
+
+// authConfigs returns the credentials for the request: those of the schemes
+// required by the operation when the request context carries its security
+// requirements and a registry or provider is set, the client config otherwise.
+func (art *AuthRoundTripper) authConfigs(req *http.Request) ([]*AuthConfig, error) {
+	ctx := req.Context()
+	if art.credentials != nil || art.provider != nil {
+		if requirements, ok := securityFromContext(ctx); ok {
+			return resolveSecurity(requirements, func(name string, scopes []string) (*AuthConfig, bool, error) {
+				return art.credential(ctx, name, scopes)
+			})
+		}
+	}
+
+	art.mu.RLock()
+	config := art.config
+	art.mu.RUnlock()
+	if art.provider != nil {
+		cred, err := art.provider.Credentials(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		if cred != nil {
+			config = cred
+		}
+	}
+	if config == nil || config.Type == AuthTypeNone {
+		return nil, nil
+	}
+	return []*AuthConfig{config}, nil
+}
+
+// applyAuth adds the credentials of config to the request.
+func applyAuth(req *http.Request, config *AuthConfig) error {
+	switch config.Type {
+	case AuthTypeNone:
 
-	switch art.config.Type {
 	case AuthTypeBasic:
-		req.SetBasicAuth(art.config.Username, art.config.Password)
+		req.SetBasicAuth(config.Username, config.Password)
 
 	case AuthTypeAPIKeyHeader:
-		if art.config.APIKeyName != "" && art.config.APIKeyValue != "" {
-			req.Header.Set(art.config.APIKeyName, art.config.APIKeyValue)
+		if config.APIKeyName != "" && config.APIKeyValue != "" {
+			req.Header.Set(config.APIKeyName, config.APIKeyValue)
 		}
 
 	case AuthTypeAPIKeyCookie:
-		if art.config.APIKeyName != "" && art.config.APIKeyValue != "" {
+		if config.APIKeyName != "" && config.APIKeyValue != "" {
 			cookie := &http.Cookie{
-				Name:  art.config.APIKeyName,
-				Value: art.config.APIKeyValue,
+				Name:  config.APIKeyName,
+				Value: config.APIKeyValue,
 			}
 			req.AddCookie(cookie)
 		}
 
+	case AuthTypeAPIKeyQuery:
+		if config.APIKeyName != "" && config.APIKeyValue != "" {
+			// Appended as is, so the serialized parameters are not re-encoded
+			param := url.QueryEscape(config.APIKeyName) + "=" + url.QueryEscape(config.APIKeyValue)
+			if req.URL.RawQuery != "" {
+				param = "&" + param
+			}
+			req.URL.RawQuery += param
+		}
+
 	case AuthTypeBearer:
-		if art.config.Token != "" {
-			req.Header.Set("Authorization", "Bearer "+art.config.Token)
+		if config.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+config.Token)
 		}
 
 	case AuthTypeOAuth2:
 		var token *oauth2.Token
 		var err error
-		if art.config.TokenSource != nil {
-			token, err = art.config.TokenSource.Token()
+		if ts, ok := config.TokenSource.(contextTokenSource); ok {
+			token, err = ts.TokenContext(req.Context())
 			if err != nil {
-				return nil, fmt.Errorf("failed to get OAuth2 token: %w", err)
+				return fmt.Errorf("failed to get OAuth2 token: %w", err)
 			}
-		} else if art.config.Token != "" {
-			token = &oauth2.Token{AccessToken: art.config.Token}
+		} else if config.TokenSource != nil {
+			token, err = config.TokenSource.Token()
+			if err != nil {
+				return fmt.Errorf("failed to get OAuth2 token: %w", err)
+			}
+		} else if config.Token != "" {
+			token = &oauth2.Token{AccessToken: config.Token}
 		} else {
-			return nil, fmt.Errorf("OAuth2 requires either Token or TokenSource")
+			return fmt.Errorf("OAuth2 requires either Token or TokenSource")
 		}
 		token.SetAuthHeader(req)
 
 	case AuthTypeCookie:
-		for _, cookie := range art.config.Cookies {
+		for _, cookie := range config.Cookies {
 			req.AddCookie(cookie)
 		}
 
+	case AuthTypeHMAC:
+		return signHMAC(req, config)
+
+	case AuthTypeAWSSigV4:
+		return signSigV4(req, config)
+
+	case AuthTypeDigest:
+		// Digest needs a challenge of the server, see AuthRoundTripper.authorizeDigest
+
 	default:
-		return nil, fmt.Errorf("unsupported auth type: %s", art.config.Type)
+		return fmt.Errorf("unsupported auth type: %s", config.Type)
 	}
+	return nil
+}
+
+// redactedError hides secrets from the message of the wrapped error
+type redactedError struct {
+	err     error
+	secrets []string
+}
+
+// Error implements the error interface.
+func (e *redactedError) Error() string {
+	msg := e.err.Error()
+	for _, secret := range e.secrets {
+		msg = strings.ReplaceAll(msg, secret, "REDACTED")
+	}
+	return msg
+}
 
-	return art.transport.RoundTrip(req)
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactSecrets hides the query API keys of configs from the error message
+func redactSecrets(err error, configs []*AuthConfig) error {
+	var secrets []string
+	for _, config := range configs {
+		if config.Type == AuthTypeAPIKeyQuery && config.APIKeyValue != "" {
+			secrets = append(secrets, config.APIKeyValue, url.QueryEscape(config.APIKeyValue))
+		}
+	}
+	if len(secrets) == 0 {
+		return err
+	}
+	return &redactedError{err: err, secrets: secrets}
+}
+
+// redactLocation removes query API keys echoed in the redirect location,
+// the redirected request gets them again from the round tripper
+func redactLocation(resp *http.Response, configs []*AuthConfig) {
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return
+	}
+	u, err := url.Parse(location)
+	if err != nil || u.RawQuery == "" {
+		return
+	}
+	// The other parameters are kept as sent, without re-encoding
+	pairs := strings.Split(u.RawQuery, "&")
+	kept := slices.DeleteFunc(slices.Clone(pairs), func(pair string) bool {
+		name, _, _ := strings.Cut(pair, "=")
+		name, _ = url.QueryUnescape(name)
+		return slices.ContainsFunc(configs, func(config *AuthConfig) bool {
+			return config.Type == AuthTypeAPIKeyQuery && config.APIKeyName == name
+		})
+	})
+	if len(kept) != len(pairs) {
+		u.RawQuery = strings.Join(kept, "&")
+		resp.Header.Set("Location", u.String())
+	}
+}
+
+// WithCredentialRegistry makes the client apply the credentials of the security
+// schemes required by each operation, instead of the global AuthConfig.
+func WithCredentialRegistry(registry *CredentialRegistry) func(*http.Client) {
+	return func(c *http.Client) {
+		if art, ok := c.Transport.(*AuthRoundTripper); ok {
+			art.credentials = registry
+		}
+	}
 }
 
 // NewHTTPClient creates an http.Client with the specified authentication.
@@ -164,7 +388,7 @@ func NewHTTPClient(config *AuthConfig, opts ...func(*http.Client)) *http.Client
 
 	// Add cookie jar if cookies are used
 	var jar http.CookieJar
-	if config.Type == AuthTypeAPIKeyCookie || config.Type == AuthTypeCookie {
+	if config != nil && (config.Type == AuthTypeAPIKeyCookie || config.Type == AuthTypeCookie) {
 		if j, err := cookiejar.New(nil); err == nil {
 			jar = j
 		}
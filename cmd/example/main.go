@@ -86,7 +86,10 @@ func main() {
 	}
 
 	// Convert to functions
-	functions := apiai.ConvertOpenAPIToFunctions(&spec)
+	functions, err := apiai.ConvertOpenAPIToFunctions(&spec)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Print generated functions
 	for _, fn := range functions {
@@ -117,15 +120,14 @@ func main() {
 	var tools []openai.ChatCompletionToolUnionParam
 	for _, fn := range functions {
 		// Convert parameters to the expected format
-		params := fn.Parameters
+		params, err := fn.ToolParameters()
+		if err != nil {
+			log.Fatal(err)
+		}
 		tools = append(tools, openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
 			Name:        fn.Name,
 			Description: openai.String(fn.Description),
-			Parameters: openai.FunctionParameters{
-				"type":       params.Type,
-				"properties": params.Properties,
-				"required":   params.Required,
-			},
+			Parameters:  params,
 		}))
 	}
 
@@ -184,7 +186,7 @@ func main() {
 		}
 
 		// Execute the function
-		result, err := apiai.ExecuteFunction(cli, fn, args)
+		result, err := apiai.ExecuteFunctionContext(ctx, cli, fn, args)
 		if err != nil {
 			log.Printf("Error executing function: %v", err)
 			// Send error message back
@@ -193,11 +195,10 @@ func main() {
 				toolCall.ID,
 			))
 		} else {
-			fmt.Printf("Function %s result: %+v\n", toolCall.Function.Name, result)
+			fmt.Printf("Function %s result: %d %s\n", toolCall.Function.Name, result.StatusCode, result.Content())
 			// Send result back to the model
-			resultJSON, _ := json.Marshal(result)
 			params.Messages = append(params.Messages, openai.ToolMessage(
-				string(resultJSON),
+				result.Content(),
 				toolCall.ID,
 			))
 		}
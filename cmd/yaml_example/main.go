@@ -78,7 +78,10 @@ paths:
 	fmt.Printf("Number of paths: %d\n", len(spec.Paths))
 
 	// Convert to function definitions
-	functions := apiai.ConvertOpenAPIToFunctions(spec)
+	functions, err := apiai.ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		log.Fatalf("Failed to convert spec: %v", err)
+	}
 	fmt.Printf("Number of functions: %d\n\n", len(functions))
 
 	// Display function information
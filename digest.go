@@ -0,0 +1,236 @@
+package apiai
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// digestChallenge is a Digest challenge of the server, cached per host and
+// user so later requests are authorized without a new challenge
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string // MD5, MD5-sess, SHA-256 or SHA-256-sess
+	qop       string // "auth", empty for servers without qop
+	stale     bool
+
+	mu sync.Mutex
+	nc uint32 // nonce count, incremented for every request with the nonce
+}
+
+// digestAlgorithms ranks the supported algorithms, stronger ones are preferred
+var digestAlgorithms = map[string]int{
+	"MD5":          1,
+	"MD5-SESS":     1,
+	"SHA-256":      2,
+	"SHA-256-SESS": 2,
+}
+
+// parseDigestChallenge picks the strongest supported Digest challenge of the
+// WWW-Authenticate header values
+func parseDigestChallenge(values []string) (*digestChallenge, bool) {
+	var best *digestChallenge
+	for _, value := range values {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(value), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		params := parseAuthParams(rest)
+		c := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+			stale:     strings.EqualFold(params["stale"], "true"),
+		}
+		if c.algorithm == "" {
+			c.algorithm = "MD5"
+		}
+		rank, ok := digestAlgorithms[strings.ToUpper(c.algorithm)]
+		if !ok || c.nonce == "" {
+			continue
+		}
+		if qop, ok := params["qop"]; ok {
+			// auth-int is not supported
+			for _, option := range strings.Split(qop, ",") {
+				if strings.TrimSpace(option) == "auth" {
+					c.qop = "auth"
+				}
+			}
+			if c.qop == "" {
+				continue
+			}
+		}
+		if best == nil || rank > digestAlgorithms[strings.ToUpper(best.algorithm)] {
+			best = c
+		}
+	}
+	return best, best != nil
+}
+
+// parseAuthParams parses the comma separated name=value parameters of a
+// challenge, values may be quoted strings
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return params
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		s = strings.TrimLeft(rest, " \t")
+
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			s = s[min(i+1, len(s)):]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+		params[name] = value.String()
+	}
+}
+
+// authorization returns the Authorization header value for the request
+// method and URI with the nonce count and client nonce
+func (c *digestChallenge) authorization(method, uri, username, password string, nc uint32, cnonce string) string {
+	var h func() hash.Hash = md5.New
+	if strings.HasPrefix(strings.ToUpper(c.algorithm), "SHA-256") {
+		h = sha256.New
+	}
+	digest := func(parts ...string) string {
+		d := h()
+		io.WriteString(d, strings.Join(parts, ":"))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	ha1 := digest(username, c.realm, password)
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		ha1 = digest(ha1, c.nonce, cnonce)
+	}
+	ha2 := digest(method, uri)
+
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, escapeQuotes(username)),
+		fmt.Sprintf(`realm="%s"`, escapeQuotes(c.realm)),
+		fmt.Sprintf(`nonce="%s"`, escapeQuotes(c.nonce)),
+		fmt.Sprintf(`uri="%s"`, escapeQuotes(uri)),
+		"algorithm=" + c.algorithm,
+	}
+	if c.qop != "" {
+		count := fmt.Sprintf("%08x", nc)
+		fields = append(fields,
+			fmt.Sprintf(`response="%s"`, digest(ha1, c.nonce, count, cnonce, c.qop, ha2)),
+			"qop="+c.qop,
+			"nc="+count,
+			fmt.Sprintf(`cnonce="%s"`, escapeQuotes(cnonce)),
+		)
+	} else {
+		fields = append(fields, fmt.Sprintf(`response="%s"`, digest(ha1, c.nonce, ha2)))
+	}
+	if c.opaque != "" {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, escapeQuotes(c.opaque)))
+	}
+	return "Digest " + strings.Join(fields, ", ")
+}
+
+// newCnonce returns a random client nonce
+func newCnonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// digestKey identifies the protection space a challenge is cached for
+func digestKey(req *http.Request, config *AuthConfig) string {
+	return req.URL.Host + "\x00" + config.Username
+}
+
+// authorizeDigest authorizes the request with the cached challenge of its host,
+// requests are sent without credentials until the server sends one
+func (art *AuthRoundTripper) authorizeDigest(req *http.Request, config *AuthConfig) {
+	art.mu.RLock()
+	c := art.digests[digestKey(req, config)]
+	art.mu.RUnlock()
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.nc++
+	nc := c.nc
+	c.mu.Unlock()
+	req.Header.Set("Authorization", c.authorization(req.Method, req.URL.RequestURI(), config.Username, config.Password, nc, newCnonce()))
+}
+
+// answerDigest caches the Digest challenge of the 401 response and sends the
+// request again with it, unless the rejected request already answered a
+// challenge that was not stale, i.e. the credentials are wrong. It reports
+// whether the request was sent again.
+func (art *AuthRoundTripper) answerDigest(req *http.Request, resp *http.Response, configs []*AuthConfig) (*http.Response, bool, error) {
+	i := -1
+	for j, config := range configs {
+		if config.Type == AuthTypeDigest {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		return resp, false, nil
+	}
+	challenge, ok := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok {
+		return resp, false, nil
+	}
+
+	art.mu.Lock()
+	if art.digests == nil {
+		art.digests = map[string]*digestChallenge{}
+	}
+	art.digests[digestKey(req, configs[i])] = challenge
+	art.mu.Unlock()
+
+	answered := strings.HasPrefix(resp.Request.Header.Get("Authorization"), "Digest ")
+	if answered && !challenge.stale {
+		return resp, false, nil
+	}
+	// The server rejects requests without credentials before processing
+	// them, so all methods are sent again when the body can be recreated
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, false, nil
+	}
+	replay := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, false, nil
+		}
+		replay.Body = body
+	}
+	io.CopyN(io.Discard, resp.Body, maxDrainLength)
+	resp.Body.Close()
+
+	resp, err := art.send(replay, configs)
+	return resp, true, err
+}
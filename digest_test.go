@@ -0,0 +1,145 @@
+package apiai
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	// Examples of RFC 7616, section 3.9.1
+	for algorithm, response := range map[string]string{
+		"MD5":     "8ca523f5e9506fed4657c9700eebdbec",
+		"SHA-256": "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+	} {
+		challenge, ok := parseDigestChallenge([]string{fmt.Sprintf(`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=%s, `+
+			`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`, algorithm)})
+		if !ok {
+			t.Fatalf("%s: failed to parse challenge", algorithm)
+		}
+		got := challenge.authorization(http.MethodGet, "/dir/index.html", "Mufasa", "Circle of Life", 1, "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ")
+		want := `Digest username="Mufasa", realm="http-auth@example.org", nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", uri="/dir/index.html", ` +
+			`algorithm=` + algorithm + `, response="` + response + `", qop=auth, nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", ` +
+			`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`
+		if got != want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", algorithm, want, got)
+		}
+	}
+
+	// SHA-256 is preferred, unsupported challenges are skipped
+	challenge, ok := parseDigestChallenge([]string{
+		`Basic realm="x"`,
+		`Digest realm="x", nonce="a", qop="auth-int"`,
+		`Digest realm="x", nonce="b", algorithm=MD5, qop="auth"`,
+		`Digest realm="x", nonce="c", algorithm=SHA-256, qop="auth"`,
+	})
+	if !ok || challenge.nonce != "c" {
+		t.Errorf("Expected the SHA-256 challenge, got %+v", challenge)
+	}
+}
+
+// digestServer is a Digest protected handler, it rotates the nonce
+// after maxUses requests and reports it as stale
+type digestServer struct {
+	algorithm, password string
+	nonce               int
+	uses, maxUses       int
+	requests            []string
+}
+
+func (s *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	auth := r.Header.Get("Authorization")
+	params := parseAuthParams(strings.TrimPrefix(auth, "Digest "))
+	s.requests = append(s.requests, fmt.Sprintf("%s %s nc=%s %s", r.Method, params["nonce"], params["nc"], body))
+
+	nonce := fmt.Sprintf("nonce-%d", s.nonce)
+	stale := false
+	if auth != "" && params["nonce"] == nonce {
+		c := &digestChallenge{realm: "appliance", nonce: nonce, algorithm: s.algorithm, qop: "auth"}
+		var nc uint32
+		fmt.Sscanf(params["nc"], "%x", &nc)
+		expected := c.authorization(r.Method, r.URL.RequestURI(), "admin", s.password, nc, params["cnonce"])
+		if parseAuthParams(strings.TrimPrefix(expected, "Digest "))["response"] == params["response"] {
+			if s.uses++; s.uses >= s.maxUses {
+				s.nonce, s.uses = s.nonce+1, 0
+			}
+			w.Write([]byte(`{}`))
+			return
+		}
+	} else if auth != "" {
+		stale = true
+	}
+	w.Header().Add("WWW-Authenticate", `Basic realm="appliance"`)
+	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm="appliance", qop="auth", algorithm=%s, nonce="%s", opaque="o", stale=%t`, s.algorithm, nonce, stale))
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func TestExecuteFunctionDigest(t *testing.T) {
+	for _, algorithm := range []string{"MD5", "SHA-256"} {
+		server := &digestServer{algorithm: algorithm, password: "secret", maxUses: 2}
+		srv := httptest.NewServer(server)
+
+		client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeDigest, Username: "admin", Password: "secret"})
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		post := &FunctionDefinition{Name: "reboot", OapiMethod: http.MethodPost, OapiPath: "/reboot"}
+		get := &FunctionDefinition{Name: "status", OapiMethod: http.MethodGet, OapiPath: "/status"}
+
+		// The challenge is answered, then the nonce is reused with
+		// an incremented count until the server reports it stale
+		if _, err := ExecuteFunction(client, post, map[string]any{"requestBody": map[string]any{"delay": 1}}); err != nil {
+			t.Fatalf("%s: failed to execute function: %v", algorithm, err)
+		}
+		for range 2 {
+			if _, err := ExecuteFunction(client, get, nil); err != nil {
+				t.Fatalf("%s: failed to execute function: %v", algorithm, err)
+			}
+		}
+		want := []string{
+			`POST  nc= {"delay":1}`,
+			`POST nonce-0 nc=00000001 {"delay":1}`,
+			`GET nonce-0 nc=00000002 `,
+			`GET nonce-0 nc=00000003 `, // stale, retried with the new nonce
+			`GET nonce-1 nc=00000001 `,
+		}
+		if strings.Join(server.requests, "|") != strings.Join(want, "|") {
+			t.Errorf("%s: expected requests\n%q\ngot\n%q", algorithm, want, server.requests)
+		}
+
+		// Wrong credentials are not retried in a loop
+		server.requests = nil
+		client, _ = NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeDigest, Username: "admin", Password: "wrong"})
+		_, err = ExecuteFunction(client, get, nil)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Response.StatusCode != http.StatusUnauthorized || len(server.requests) != 2 {
+			t.Errorf("%s: expected 401 after 2 requests, got %v and %q", algorithm, err, server.requests)
+		}
+		srv.Close()
+	}
+}
+
+func TestDigestAfterQueryKey(t *testing.T) {
+	digest := &digestServer{algorithm: "MD5", password: "secret", maxUses: 10}
+	srv := httptest.NewServer(digest)
+	defer srv.Close()
+
+	registry, err := NewCredentialRegistry(nil)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	// Sorted by name the digest comes first, its uri must still include the key
+	registry.Set("a-digest", &AuthConfig{Type: AuthTypeDigest, Username: "admin", Password: "secret"})
+	registry.Set("b-key", &AuthConfig{Type: AuthTypeAPIKeyQuery, APIKeyName: "key", APIKeyValue: "k"})
+
+	client, _ := NewAPIClient(srv.URL, nil, WithCredentialRegistry(registry))
+	fn := &FunctionDefinition{Name: "get", OapiMethod: http.MethodGet, OapiPath: "/", Security: []SecurityRequirement{{"a-digest": nil, "b-key": nil}}}
+	if _, err := ExecuteFunction(client, fn, nil); err != nil {
+		t.Fatalf("Expected the digest to cover the query key, got %v (requests %q)", err, digest.requests)
+	}
+}
@@ -1,53 +1,177 @@
 package apiai
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"time"
 )
 
+// MissingArgumentError is returned before any request is made
+// when required arguments are absent or null
+type MissingArgumentError struct {
+	Function  string
+	Arguments []string
+}
+
+// Error implements the error interface.
+func (e *MissingArgumentError) Error() string {
+	return fmt.Sprintf("%s: missing required arguments: %s", e.Function, strings.Join(e.Arguments, ", "))
+}
+
+// resolveArguments returns the values to send by parameter name. Absent and null
+// arguments of optional parameters are not sent, unless a default is applied or
+// the schema is nullable, then null is sent as an empty value. Empty values are
+// sent as is, except in the path where a segment can not be empty.
+func resolveArguments(client *APIClient, fn *FunctionDefinition, args map[string]any) (map[string]any, error) {
+	values := map[string]any{}
+	var missing []string
+
+	for _, group := range []struct {
+		in    string
+		names []string
+	}{
+		{"path", fn.PathParams},
+		{"query", fn.QueryParams},
+		{"header", fn.HeaderParams},
+		{"cookie", fn.CookieParams},
+	} {
+		for _, name := range group.names {
+			v, ok := args[name]
+			if v, isString := v.(string); group.in == "path" && isString && v == "" {
+				ok = false
+			}
+			prop := fn.Parameters.Properties[name]
+
+			switch {
+			case v != nil && ok:
+				values[name] = v
+			case ok && group.in != "path" && prop != nil && prop.Nullable:
+				values[name] = nil
+			case fn.requiredArgument(name, group.in):
+				missing = append(missing, name)
+			case client.ApplyDefaults && prop != nil && prop.Default != nil:
+				values[name] = prop.Default
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, &MissingArgumentError{Function: fn.Name, Arguments: missing}
+	}
+	return values, nil
+}
+
+// requiredArgument reports whether the model must provide the argument
+func (fn *FunctionDefinition) requiredArgument(name, in string) bool {
+	if in == "path" || slices.Contains(fn.Parameters.Required, name) {
+		return true
+	}
+	p, ok := fn.OapiParams[name]
+	return ok && p.In == in && p.Required
+}
+
 // Execute API request
-func executeAPIRequest(client *APIClient, fn *FunctionDefinition, requestBody any, args map[string]any) (any, error) {
-	// Build URL with path parameters
-	u := client.BaseURL.JoinPath(fn.OapiPath).String()
+func executeAPIRequest(ctx context.Context, client *APIClient, fn *FunctionDefinition, requestBody any, args map[string]any) (*APIResponse, error) {
+	if len(fn.BoundArgs) > 0 {
+		merged := make(map[string]any, len(args)+len(fn.BoundArgs))
+		maps.Copy(merged, args)
+		maps.Copy(merged, fn.BoundArgs)
+		args = merged
+	}
 
-	for _, pp := range fn.PathParams {
-		u = strings.ReplaceAll(u, fmt.Sprintf("{%s}", pp), url.PathEscape(fmt.Sprint(args[pp])))
+	if requestBody == nil && fn.requiredArgument("requestBody", "body") {
+		return nil, &MissingArgumentError{Function: fn.Name, Arguments: []string{"requestBody"}}
+	}
+	values, err := resolveArguments(client, fn, args)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(fn.QueryParams) > 0 {
-		uu, err := url.Parse(u)
+	// Build URL with path parameters, substituted before joining
+	// because the base URL escapes the template braces
+	p := fn.OapiPath
+	for _, pp := range fn.PathParams {
+		v, err := serializePathParam(fn.parameter(pp, "path"), values[pp])
 		if err != nil {
 			return nil, err
 		}
-		uq := uu.Query()
+		p = strings.ReplaceAll(p, fmt.Sprintf("{%s}", pp), v)
+	}
+	base, err := client.baseURL(fn)
+	if err != nil {
+		return nil, err
+	}
+	uu := joinEscapedPath(base, p)
+
+	if len(fn.QueryParams) > 0 {
+		var pairs []string
+		if uu.RawQuery != "" {
+			pairs = append(pairs, uu.RawQuery)
+		}
 		for _, qp := range fn.QueryParams {
-			uq.Set(qp, fmt.Sprint(args[qp]))
+			v, ok := values[qp]
+			if !ok {
+				continue
+			}
+			qv, err := serializeQueryParam(fn.parameter(qp, "query"), v)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, qv...)
 		}
-		uu.RawQuery = uq.Encode()
-		u = uu.String()
+		uu.RawQuery = strings.Join(pairs, "&")
 	}
+	u := uu.String()
 
-	var body []byte
-	var err error
+	body, contentType, err := encodeRequestBody(fn, requestBody, args)
+	if err != nil {
+		return nil, err
+	}
 
-	if requestBody != nil {
-		body, err = json.Marshal(requestBody)
-		if err != nil {
-			return nil, err
-		}
+	if timeout := client.functionTimeout(fn.Name); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// Functions without declared security keep the client AuthConfig
+	if fn.Security != nil {
+		ctx = ContextWithSecurity(ctx, fn.Security)
 	}
 
-	req, err := http.NewRequest(fn.OapiMethod, u, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, fn.OapiMethod, u, body)
 	if err != nil {
 		return nil, err
 	}
 
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	for _, hp := range fn.HeaderParams {
+		if v, ok := values[hp]; ok {
+			hv, err := serializeHeaderParam(fn.parameter(hp, "header"), v)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set(hp, hv)
+		}
+	}
+
+	for _, cp := range fn.CookieParams {
+		if v, ok := values[cp]; ok {
+			cookies, err := serializeCookieParam(fn.parameter(cp, "cookie"), v)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+		}
 	}
 
 	resp, err := client.HTTPClient.Do(req)
@@ -56,17 +180,61 @@ func executeAPIRequest(client *APIClient, fn *FunctionDefinition, requestBody an
 	}
 	defer resp.Body.Close()
 
-	var result any
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	result, err := readAPIResponse(resp)
+	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &APIError{Method: fn.OapiMethod, Path: fn.OapiPath, Response: result}
+	}
 
 	return result, nil
 }
 
-// ExecuteFunction calls the registered function handler
-func ExecuteFunction(client *APIClient, fn *FunctionDefinition, arguments map[string]any) (any, error) {
+// ExecuteFunction calls the registered function handler.
+// A non-2xx response is returned as *APIError.
+func ExecuteFunction(client *APIClient, fn *FunctionDefinition, arguments map[string]any) (*APIResponse, error) {
+	return ExecuteFunctionContext(context.Background(), client, fn, arguments)
+}
+
+// ExecuteFunctionContext is like ExecuteFunction, the request is canceled with ctx
+// or when the client timeout for the function expires
+func ExecuteFunctionContext(ctx context.Context, client *APIClient, fn *FunctionDefinition, arguments map[string]any) (*APIResponse, error) {
+	if client.ValidateArguments {
+		var err error
+		arguments, err = ValidateArguments(fn, arguments, client.CoerceArguments)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	requestBody := arguments["requestBody"]
 
-	return executeAPIRequest(client, fn, requestBody, arguments)
+	return executeAPIRequest(ctx, client, fn, requestBody, arguments)
+}
+
+// joinEscapedPath appends the escaped operation path to the base URL. Unlike
+// url.JoinPath it does not clean the path, and segments made of dots only are
+// percent-encoded, so an argument like ".." can not select another endpoint.
+func joinEscapedPath(base *url.URL, p string) *url.URL {
+	segments := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, s := range segments {
+		if s != "" && strings.Trim(s, ".") == "" {
+			segments[i] = strings.ReplaceAll(s, ".", "%2E")
+		}
+	}
+	raw := strings.TrimSuffix(base.EscapedPath(), "/") + "/" + strings.Join(segments, "/")
+
+	u := *base
+	u.RawPath = raw
+	u.Path, _ = url.PathUnescape(raw)
+	return &u
+}
+
+// functionTimeout returns the timeout for the named function
+func (c *APIClient) functionTimeout(name string) time.Duration {
+	if timeout, ok := c.FunctionTimeouts[name]; ok {
+		return timeout
+	}
+	return c.Timeout
 }
@@ -0,0 +1,315 @@
+package apiai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteFunctionPathParams(t *testing.T) {
+	var gotPath, gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"id": 42})
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL+"/v1", &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	fn := &FunctionDefinition{
+		Name:        "get_pets_id",
+		OapiMethod:  http.MethodGet,
+		OapiPath:    "/pets/{id}",
+		PathParams:  []string{"id"},
+		QueryParams: []string{"verbose"},
+	}
+
+	result, err := ExecuteFunction(client, fn, map[string]any{"id": "a/b 42", "verbose": true})
+	if err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+
+	if gotPath != "/v1/pets/a%2Fb%2042" {
+		t.Errorf("Unexpected request path %q", gotPath)
+	}
+	if gotQuery != "verbose=true" {
+		t.Errorf("Unexpected request query %q", gotQuery)
+	}
+	if m, ok := result.Body.(map[string]any); !ok || m["id"] != float64(42) || result.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+func TestExecuteFunctionDotPathParams(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL+"/api/", &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	fn := &FunctionDefinition{Name: "profile", OapiMethod: http.MethodGet, OapiPath: "/users/{id}/profile", PathParams: []string{"id"}}
+
+	// Dot segments must not select another endpoint
+	for id, want := range map[string]string{
+		"..":  "/api/users/%2E%2E/profile",
+		".":   "/api/users/%2E/profile",
+		"a.b": "/api/users/a.b/profile",
+	} {
+		if _, err := ExecuteFunction(client, fn, map[string]any{"id": id}); err != nil {
+			t.Fatalf("%q: failed to execute function: %v", id, err)
+		}
+		if gotPath != want {
+			t.Errorf("%q: expected path %q, got %q", id, want, gotPath)
+		}
+	}
+
+	// Label style prefixes a dot
+	fn.OapiPath = "/users/{id}"
+	fn.OapiParams = map[string]*Parameter{"id": {Name: "id", In: "path", Style: StyleLabel}}
+	if _, err := ExecuteFunction(client, fn, map[string]any{"id": "."}); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	if gotPath != "/api/users/%2E%2E" {
+		t.Errorf("Unexpected label path %q", gotPath)
+	}
+}
+
+func TestExecuteFunctionHeaderAndCookieParams(t *testing.T) {
+	specYAML := `
+openapi: 3.0.0
+info:
+  title: Tenants
+  version: 1.0.0
+paths:
+  /items/{id}:
+    put:
+      summary: Update an item
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+        - name: X-Tenant-ID
+          in: header
+          required: true
+          schema:
+            type: string
+        - name: If-Match
+          in: header
+          schema:
+            type: string
+        - name: Accept
+          in: header
+          schema:
+            type: string
+        - name: session
+          in: cookie
+          schema:
+            type: string
+`
+
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(specYAML))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+
+	functions, err := ConvertOpenAPIToFunctions(spec, WithBoundParameter("header", "X-Tenant-ID", "acme"))
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	fn := functions["put_items_id"]
+	if len(fn.HeaderParams) != 2 || len(fn.CookieParams) != 1 {
+		t.Errorf("Unexpected header %v and cookie %v params", fn.HeaderParams, fn.CookieParams)
+	}
+	if _, ok := fn.Parameters.Properties["X-Tenant-ID"]; ok {
+		t.Errorf("Expected bound header to be hidden from the schema")
+	}
+	if _, ok := fn.Parameters.Properties["Accept"]; ok {
+		t.Errorf("Expected Accept header parameter to be ignored")
+	}
+	if _, ok := fn.Parameters.Properties["If-Match"]; !ok {
+		t.Errorf("Expected If-Match header in the schema")
+	}
+	if _, ok := fn.Parameters.Properties["session"]; !ok {
+		t.Errorf("Expected session cookie in the schema")
+	}
+	if len(fn.Parameters.Required) != 1 || fn.Parameters.Required[0] != "id" {
+		t.Errorf("Expected only id to be required, got %v", fn.Parameters.Required)
+	}
+
+	var gotTenant, gotIfMatch, gotSession string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTenant = r.Header.Get("X-Tenant-ID")
+		gotIfMatch = r.Header.Get("If-Match")
+		if c, err := r.Cookie("session"); err == nil {
+			gotSession = c.Value
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	// The model can not override a bound value
+	_, err = ExecuteFunction(client, fn, map[string]any{
+		"id":          "1",
+		"X-Tenant-ID": "other",
+		"If-Match":    `"v1"`,
+		"session":     "abc",
+	})
+	if err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+
+	if gotTenant != "acme" || gotIfMatch != `"v1"` || gotSession != "abc" {
+		t.Errorf("Unexpected header/cookie values: tenant=%q if-match=%q session=%q", gotTenant, gotIfMatch, gotSession)
+	}
+}
+
+func TestExecuteFunctionArgumentPresence(t *testing.T) {
+	var requests int
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		gotQuery = r.URL.RawQuery
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	fn := &FunctionDefinition{
+		Name:        "list_pets",
+		OapiMethod:  http.MethodGet,
+		OapiPath:    "/owners/{owner}/pets",
+		PathParams:  []string{"owner"},
+		QueryParams: []string{"limit", "q", "cursor", "kind"},
+		Parameters: Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"owner":  {Type: "string"},
+				"limit":  {Type: "integer", Default: float64(20)},
+				"q":      {Type: "string"},
+				"cursor": {Type: "string", Nullable: true},
+				"kind":   {Type: "string"},
+			},
+			Required: []string{"owner", "kind"},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		applyDefaults bool
+		args          map[string]any
+		wantQuery     string
+		wantMissing   []string
+	}{
+		{"absent optional", false, map[string]any{"owner": "bob", "kind": "cat"}, "kind=cat", nil},
+		{"default applied", true, map[string]any{"owner": "bob", "kind": "cat"}, "limit=20&kind=cat", nil},
+		{"null optional", true, map[string]any{"owner": "bob", "kind": "cat", "limit": nil, "q": nil}, "limit=20&kind=cat", nil},
+		{"null nullable", false, map[string]any{"owner": "bob", "kind": "cat", "cursor": nil}, "cursor=&kind=cat", nil},
+		{"empty", false, map[string]any{"owner": "bob", "kind": "cat", "q": ""}, "q=&kind=cat", nil},
+		{"missing required", true, map[string]any{"kind": nil}, "", []string{"owner", "kind"}},
+		{"empty path", false, map[string]any{"owner": "", "kind": "cat"}, "", []string{"owner"}},
+	}
+	for _, tt := range tests {
+		requests, gotQuery = 0, ""
+		client.ApplyDefaults = tt.applyDefaults
+
+		_, err := ExecuteFunction(client, fn, tt.args)
+		if tt.wantMissing != nil {
+			var missing *MissingArgumentError
+			if !errors.As(err, &missing) {
+				t.Errorf("%s: expected MissingArgumentError, got %v", tt.name, err)
+				continue
+			}
+			if strings.Join(missing.Arguments, ",") != strings.Join(tt.wantMissing, ",") {
+				t.Errorf("%s: expected missing %v, got %v", tt.name, tt.wantMissing, missing.Arguments)
+			}
+			if requests != 0 {
+				t.Errorf("%s: expected no request to be made", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if gotQuery != tt.wantQuery {
+			t.Errorf("%s: expected query %q, got %q", tt.name, tt.wantQuery, gotQuery)
+		}
+	}
+}
+
+func TestExecuteFunctionContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	slow := &FunctionDefinition{Name: "slow", OapiMethod: http.MethodGet, OapiPath: "/slow"}
+	fast := &FunctionDefinition{Name: "fast", OapiMethod: http.MethodGet, OapiPath: "/fast"}
+
+	// Caller deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ExecuteFunctionContext(ctx, client, slow, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+
+	// Client timeout with a per-function override
+	client.Timeout = time.Hour
+	client.FunctionTimeouts = map[string]time.Duration{"slow": 50 * time.Millisecond}
+	start := time.Now()
+	if _, err := ExecuteFunction(client, slow, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Function timeout was not applied, took %v", elapsed)
+	}
+	if _, err := ExecuteFunction(client, fast, nil); err != nil {
+		t.Errorf("Expected fast function to succeed, got %v", err)
+	}
+
+	// Canceled before the call
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := ExecuteFunctionContext(ctx, client, fast, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled, got %v", err)
+	}
+}
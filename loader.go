@@ -0,0 +1,360 @@
+package apiai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SpecLoader loads raw spec documents (JSON or YAML) by location
+type SpecLoader interface {
+	Load(ctx context.Context, location *url.URL) ([]byte, error)
+}
+
+// SpecLoaderFunc is an adapter to use ordinary functions as SpecLoader
+type SpecLoaderFunc func(ctx context.Context, location *url.URL) ([]byte, error)
+
+// Load calls f(ctx, location)
+func (f SpecLoaderFunc) Load(ctx context.Context, location *url.URL) ([]byte, error) {
+	return f(ctx, location)
+}
+
+// NewSpecLoader creates a loader that reads relative and file locations from fsys
+// and http(s) locations with client. A nil client means http.DefaultClient.
+func NewSpecLoader(fsys fs.FS, client *http.Client) SpecLoader {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &specLoader{fsys: fsys, client: client}
+}
+
+type specLoader struct {
+	fsys   fs.FS
+	client *http.Client
+}
+
+// Load implements the SpecLoader interface.
+func (l *specLoader) Load(ctx context.Context, location *url.URL) ([]byte, error) {
+	switch location.Scheme {
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := l.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to load %s: %s", location, resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+
+	case "", "file":
+		if l.fsys == nil {
+			return nil, fmt.Errorf("failed to load %s: no file system configured", location)
+		}
+		return fs.ReadFile(l.fsys, strings.TrimPrefix(path.Clean(location.Path), "/"))
+
+	default:
+		return nil, fmt.Errorf("unsupported spec location scheme %q", location.Scheme)
+	}
+}
+
+// LoadOpenAPISpec loads the spec at location and follows relative-file and URL $refs
+// using loader. Every external document is loaded once and the referenced parts are
+// bundled into a single spec that only contains local $refs.
+// Recursive external schemas are moved to components.schemas.
+func LoadOpenAPISpec(ctx context.Context, location string, loader SpecLoader) (*OpenAPISpec, error) {
+	root, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	root.Fragment = ""
+	if root.Scheme == "" && !strings.HasPrefix(root.Path, "/") {
+		// Keep relative locations rooted, so they compare equal after reference resolution
+		root.Path = "/" + root.Path
+	}
+
+	b := &specBundler{
+		ctx:      ctx,
+		loader:   loader,
+		root:     root,
+		docs:     map[string]any{},
+		inlining: map[string]bool{},
+		hoisted:  map[string]string{},
+		schemas:  map[string]any{},
+	}
+
+	doc, err := b.loadDocument(root)
+	if err != nil {
+		return nil, err
+	}
+	bundled, err := b.walk(doc, root)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b.schemas) > 0 {
+		if err := b.addHoistedSchemas(bundled); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(bundled)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalOpenAPISpec(data)
+}
+
+// specBundler inlines external references into the root document
+type specBundler struct {
+	ctx    context.Context
+	loader SpecLoader
+	root   *url.URL
+
+	// docs caches decoded documents by location
+	docs map[string]any
+	// inlining holds external refs being inlined on the current branch
+	inlining map[string]bool
+	// hoisted maps recursive external refs to their local components.schemas refs
+	hoisted map[string]string
+	// schemas holds hoisted schemas by component name
+	schemas map[string]any
+}
+
+func documentKey(u *url.URL) string {
+	d := *u
+	d.Fragment = ""
+	d.RawFragment = ""
+	if d.Scheme == "" || d.Scheme == "file" {
+		d.Path = path.Clean(d.Path)
+	}
+	return d.String()
+}
+
+func (b *specBundler) loadDocument(u *url.URL) (any, error) {
+	key := documentKey(u)
+	if doc, ok := b.docs[key]; ok {
+		return doc, nil
+	}
+
+	loc := *u
+	loc.Fragment = ""
+	loc.RawFragment = ""
+	data, err := b.loader.Load(b.ctx, &loc)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, so one decoder handles both formats
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", &loc, err)
+	}
+	doc = normalizeYAMLValue(doc)
+
+	b.docs[key] = doc
+	return doc, nil
+}
+
+// walk copies node, replacing external $refs with the referenced content.
+// base is the location of the document containing node.
+func (b *specBundler) walk(node any, base *url.URL) (any, error) {
+	switch v := node.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			return b.walkRef(v, ref, base)
+		}
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			walked, err := b.walk(value, base)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = walked
+		}
+		return out, nil
+
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			walked, err := b.walk(value, base)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = walked
+		}
+		return out, nil
+
+	default:
+		return node, nil
+	}
+}
+
+func (b *specBundler) walkRef(node map[string]any, ref string, base *url.URL) (any, error) {
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref %q: %w", ref, err)
+	}
+	target := base.ResolveReference(refURL)
+
+	if documentKey(target) == documentKey(b.root) {
+		out := make(map[string]any, len(node))
+		for key, value := range node {
+			out[key] = value
+		}
+		out["$ref"] = "#" + target.EscapedFragment()
+		return out, nil
+	}
+
+	key := target.String()
+	if local, ok := b.hoisted[key]; ok {
+		return map[string]any{"$ref": local}, nil
+	}
+	if b.inlining[key] {
+		// A recursive reference can not be inlined, move the target into components instead
+		local := "#/components/schemas/" + b.hoistName(target)
+		b.hoisted[key] = local
+		return map[string]any{"$ref": local}, nil
+	}
+
+	doc, err := b.loadDocument(target)
+	if err != nil {
+		return nil, err
+	}
+	content, err := lookupPointer(doc, target.EscapedFragment())
+	if err != nil {
+		return nil, fmt.Errorf("unresolved $ref %q in %s: %w", ref, documentKey(base), err)
+	}
+
+	b.inlining[key] = true
+	walked, err := b.walk(content, target)
+	delete(b.inlining, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if local, ok := b.hoisted[key]; ok {
+		b.schemas[strings.TrimPrefix(local, "#/components/schemas/")] = walked
+		return map[string]any{"$ref": local}, nil
+	}
+	return walked, nil
+}
+
+// hoistName picks an unused components.schemas name for an external ref
+func (b *specBundler) hoistName(target *url.URL) string {
+	name := path.Base(target.Fragment)
+	if name == "" || name == "." || name == "/" {
+		name = strings.TrimSuffix(path.Base(target.Path), path.Ext(target.Path))
+	}
+
+	taken := func(n string) bool {
+		if _, ok := b.schemas[n]; ok {
+			return true
+		}
+		for _, local := range b.hoisted {
+			if local == "#/components/schemas/"+n {
+				return true
+			}
+		}
+		if rootDoc, ok := b.docs[documentKey(b.root)].(map[string]any); ok {
+			if _, err := lookupPointer(rootDoc, "/components/schemas/"+n); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	candidate := name
+	for i := 2; taken(candidate); i++ {
+		candidate = name + strconv.Itoa(i)
+	}
+	return candidate
+}
+
+func (b *specBundler) addHoistedSchemas(bundled any) error {
+	doc, ok := bundled.(map[string]any)
+	if !ok {
+		return fmt.Errorf("spec root must be an object")
+	}
+	components, _ := doc["components"].(map[string]any)
+	if components == nil {
+		components = map[string]any{}
+		doc["components"] = components
+	}
+	schemas, _ := components["schemas"].(map[string]any)
+	if schemas == nil {
+		schemas = map[string]any{}
+		components["schemas"] = schemas
+	}
+	for name, schema := range b.schemas {
+		schemas[name] = schema
+	}
+	return nil
+}
+
+// lookupPointer resolves a JSON Pointer fragment in a decoded document
+func lookupPointer(doc any, fragment string) (any, error) {
+	tokens, err := parseRefPointer("#" + fragment)
+	if err != nil {
+		return nil, err
+	}
+
+	node := doc
+	for _, token := range tokens {
+		switch v := node.(type) {
+		case map[string]any:
+			next, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("%q not found", token)
+			}
+			node = next
+		case []any:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, fmt.Errorf("invalid index %q", token)
+			}
+			node = v[idx]
+		default:
+			return nil, fmt.Errorf("%q not found", token)
+		}
+	}
+	return node, nil
+}
+
+// normalizeYAMLValue converts YAML mappings with non-string keys (e.g. response codes)
+// to map[string]any, so the document can be encoded as JSON
+func normalizeYAMLValue(node any) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = normalizeYAMLValue(value)
+		}
+		return v
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			out[fmt.Sprint(key)] = normalizeYAMLValue(value)
+		}
+		return out
+	case []any:
+		for i, value := range v {
+			v[i] = normalizeYAMLValue(value)
+		}
+		return v
+	default:
+		return node
+	}
+}
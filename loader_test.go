@@ -0,0 +1,168 @@
+package apiai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadOpenAPISpecMultiFile(t *testing.T) {
+	var sharedLoads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shared.json" {
+			http.NotFound(w, r)
+			return
+		}
+		sharedLoads++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Error": {"type": "object", "properties": {"message": {"type": "string"}}}}`))
+	}))
+	defer srv.Close()
+
+	fsys := fstest.MapFS{
+		"api/openapi.yaml": {Data: []byte(`
+openapi: 3.0.0
+info:
+  title: Users
+  version: 1.0.0
+paths:
+  /users:
+    post:
+      summary: Create a user
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: './schemas/user.yaml#/User'
+  /users/{id}:
+    get:
+      summary: Get a user
+      parameters:
+        - $ref: '#/components/parameters/UserID'
+  /errors:
+    get:
+      summary: Last error
+      parameters:
+        - name: filter
+          in: query
+          schema:
+            $ref: '` + srv.URL + `/shared.json#/Error'
+        - name: other
+          in: query
+          schema:
+            $ref: '` + srv.URL + `/shared.json#/Error'
+components:
+  parameters:
+    UserID:
+      name: id
+      in: path
+      required: true
+      schema:
+        type: string
+`)},
+		"api/schemas/user.yaml": {Data: []byte(`
+User:
+  type: object
+  properties:
+    name:
+      type: string
+    address:
+      $ref: '../common.yaml#/Address'
+    tags:
+      $ref: '#/Tag'
+    friend:
+      $ref: '#/User'
+  required: [name]
+Tag:
+  type: string
+`)},
+		"api/common.yaml": {Data: []byte(`
+Address:
+  type: object
+  properties:
+    city:
+      type: string
+`)},
+	}
+
+	var fileLoads int
+	base := NewSpecLoader(fsys, srv.Client())
+	loader := SpecLoaderFunc(func(ctx context.Context, location *url.URL) ([]byte, error) {
+		if location.Scheme == "" {
+			fileLoads++
+		}
+		return base.Load(ctx, location)
+	})
+
+	spec, err := LoadOpenAPISpec(context.Background(), "api/openapi.yaml", loader)
+	if err != nil {
+		t.Fatalf("Failed to load spec: %v", err)
+	}
+
+	if fileLoads != 3 {
+		t.Errorf("Expected 3 file loads, got %d", fileLoads)
+	}
+	if sharedLoads != 1 {
+		t.Errorf("Expected shared document to be loaded once, got %d", sharedLoads)
+	}
+
+	// The recursive User schema is moved to components, everything else is inlined
+	user := spec.Components.Schemas["User"]
+	if user == nil {
+		t.Fatalf("Expected recursive User schema in components.schemas")
+	}
+	if user.Properties["address"].Properties["city"] == nil {
+		t.Errorf("Expected Address to be inlined, got %+v", user.Properties["address"])
+	}
+	if user.Properties["tags"].Type != "string" {
+		t.Errorf("Expected Tag to be inlined, got %+v", user.Properties["tags"])
+	}
+	if user.Properties["friend"].Ref != "#/components/schemas/User" {
+		t.Errorf("Expected friend to reference the hoisted User, got %q", user.Properties["friend"].Ref)
+	}
+	body := spec.Paths["/users"].Post.RequestBody.Content["application/json"].Schema
+	if body.Ref != "#/components/schemas/User" {
+		t.Errorf("Expected request body to reference the hoisted User, got %q", body.Ref)
+	}
+
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	if len(functions) != 3 {
+		t.Errorf("Expected 3 functions, got %d", len(functions))
+	}
+	if p := functions["get_users_id"].Parameters.Properties["id"]; p == nil || p.Type != "string" {
+		t.Errorf("Expected local parameter ref to be kept and resolved, got %+v", p)
+	}
+	if p := functions["get_errors"].Parameters.Properties["filter"]; p == nil || p.Properties["message"] == nil {
+		t.Errorf("Expected URL ref to be inlined, got %+v", p)
+	}
+}
+
+func TestLoadOpenAPISpecMissingRef(t *testing.T) {
+	fsys := fstest.MapFS{
+		"openapi.yaml": {Data: []byte(`
+openapi: 3.0.0
+info:
+  title: Broken
+  version: 1.0.0
+paths:
+  /a:
+    get:
+      parameters:
+        - $ref: 'params.yaml#/Missing'
+`)},
+		"params.yaml": {Data: []byte(`Present: {name: a, in: query}`)},
+	}
+
+	if _, err := LoadOpenAPISpec(context.Background(), "openapi.yaml", NewSpecLoader(fsys, nil)); err == nil {
+		t.Errorf("Expected error for a missing external target")
+	}
+	if _, err := LoadOpenAPISpec(context.Background(), "missing.yaml", NewSpecLoader(fsys, nil)); err == nil {
+		t.Errorf("Expected error for a missing document")
+	}
+}
@@ -0,0 +1,153 @@
+package apiai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// maxFunctionNameLength is the longest function name accepted by OpenAI
+const maxFunctionNameLength = 64
+
+// FunctionNamer picks the function name for an operation.
+// Names are sanitized and deduplicated afterwards, so a namer may return any string.
+type FunctionNamer interface {
+	FunctionName(method, path string, op *Operation) string
+}
+
+// FunctionNamerFunc is an adapter to use ordinary functions as FunctionNamer
+type FunctionNamerFunc func(method, path string, op *Operation) string
+
+// FunctionName calls f(method, path, op)
+func (f FunctionNamerFunc) FunctionName(method, path string, op *Operation) string {
+	return f(method, path, op)
+}
+
+var (
+	// PathNamer names functions by method and path, e.g. "get_pets_id" for GET /pets/{id}
+	PathNamer FunctionNamer = FunctionNamerFunc(pathFunctionName)
+
+	// OperationIDNamer names functions by operationId, falling back to PathNamer
+	OperationIDNamer FunctionNamer = FunctionNamerFunc(func(method, path string, op *Operation) string {
+		if op != nil && op.OperationID != "" {
+			return op.OperationID
+		}
+		return pathFunctionName(method, path, op)
+	})
+)
+
+// WithFunctionNamer sets the naming strategy, OperationIDNamer by default
+func WithFunctionNamer(namer FunctionNamer) ConvertOption {
+	return func(o *convertOptions) {
+		o.namer = namer
+	}
+}
+
+// FunctionRename describes a function whose name differs from the one
+// picked by the namer
+type FunctionRename struct {
+	Method    string
+	Path      string
+	Requested string // name returned by the namer
+	Name      string // name of the generated function
+	Reason    string // "sanitized", "truncated" or "collision"
+}
+
+// WithRenameHandler registers fn to be called for every renamed function,
+// so callers can map generated names back to the requested ones
+func WithRenameHandler(fn func(FunctionRename)) ConvertOption {
+	return func(o *convertOptions) {
+		o.onRename = fn
+	}
+}
+
+// pathFunctionName builds a name from method and path
+func pathFunctionName(method, path string, _ *Operation) string {
+	name := strings.ReplaceAll(path, "/", "_")
+	name = strings.ReplaceAll(name, "{", "")
+	name = strings.ReplaceAll(name, "}", "")
+	name = method + name
+	return strings.ToLower(name)
+}
+
+// functionNames hands out valid and unique function names
+type functionNames struct {
+	namer    FunctionNamer
+	onRename func(FunctionRename)
+	used     map[string]bool
+}
+
+func newFunctionNames(namer FunctionNamer, onRename func(FunctionRename)) *functionNames {
+	if namer == nil {
+		namer = OperationIDNamer
+	}
+	return &functionNames{
+		namer:    namer,
+		onRename: onRename,
+		used:     map[string]bool{},
+	}
+}
+
+// name returns a name matching ^[a-zA-Z0-9_-]{1,64}$ that was not returned before
+func (n *functionNames) name(method, path string, op *Operation) string {
+	requested := n.namer.FunctionName(method, path, op)
+
+	name, reason := sanitizeFunctionName(requested)
+
+	if n.used[name] {
+		base := name
+		for i := 2; n.used[name]; i++ {
+			suffix := "_" + strconv.Itoa(i)
+			name = truncateFunctionName(base, maxFunctionNameLength-len(suffix)) + suffix
+		}
+		reason = "collision"
+	}
+	n.used[name] = true
+
+	if name != requested && n.onRename != nil {
+		n.onRename(FunctionRename{
+			Method:    method,
+			Path:      path,
+			Requested: requested,
+			Name:      name,
+			Reason:    reason,
+		})
+	}
+	return name
+}
+
+// sanitizeFunctionName replaces characters not allowed in function names
+// and shortens names longer than the limit
+func sanitizeFunctionName(requested string) (string, string) {
+	var reason string
+
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, requested)
+	if name != requested {
+		reason = "sanitized"
+	}
+	if name == "" {
+		name, reason = "function", "sanitized"
+	}
+
+	if len(name) > maxFunctionNameLength {
+		name, reason = truncateFunctionName(name, maxFunctionNameLength), "truncated"
+	}
+	return name, reason
+}
+
+// truncateFunctionName shortens name to limit, replacing the tail with a hash
+// of the full name so that names sharing a long prefix stay distinct
+func truncateFunctionName(name string, limit int) string {
+	if len(name) <= limit {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:4])
+	return name[:limit-len(hash)-1] + "_" + hash
+}
@@ -0,0 +1,104 @@
+package apiai
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestConvertOpenAPIToFunctionsNaming(t *testing.T) {
+	longID := strings.Repeat("listAllThePetsOfTheStore", 4)
+	spec := &OpenAPISpec{
+		OpenAPI: "3.0.0",
+		Paths: map[string]PathItem{
+			"/pets":         {Get: &Operation{OperationID: "listPets"}},
+			"/pets/{id}":    {Get: &Operation{}},
+			"/pets/id":      {Get: &Operation{}},
+			"/pets.json":    {Get: &Operation{}},
+			"/store/search": {Get: &Operation{OperationID: "store.search"}},
+			"/long/a":       {Get: &Operation{OperationID: longID + "A"}},
+			"/long/b":       {Get: &Operation{OperationID: longID + "B"}},
+		},
+	}
+
+	var renames []FunctionRename
+	functions, err := ConvertOpenAPIToFunctions(spec, WithRenameHandler(func(r FunctionRename) {
+		renames = append(renames, r)
+	}))
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	validName := regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	byPath := map[string]*FunctionDefinition{}
+	for name, fn := range functions {
+		if !validName.MatchString(name) {
+			t.Errorf("Invalid function name %q", name)
+		}
+		byPath[fn.OapiPath] = fn
+	}
+	if len(functions) != 7 {
+		t.Fatalf("Expected 7 functions, got %d", len(functions))
+	}
+
+	if fn := byPath["/pets"]; fn.Name != "listPets" || fn.OperationID != "listPets" {
+		t.Errorf("Expected operationId to be used, got %q", fn.Name)
+	}
+	// Sorted paths make the collision suffix deterministic
+	if byPath["/pets/id"].Name != "get_pets_id" || byPath["/pets/{id}"].Name != "get_pets_id_2" {
+		t.Errorf("Unexpected collision names %q and %q", byPath["/pets/id"].Name, byPath["/pets/{id}"].Name)
+	}
+	if byPath["/pets.json"].Name != "get_pets_json" {
+		t.Errorf("Unexpected sanitized name %q", byPath["/pets.json"].Name)
+	}
+	if byPath["/store/search"].Name != "store_search" {
+		t.Errorf("Unexpected sanitized name %q", byPath["/store/search"].Name)
+	}
+	a, b := byPath["/long/a"].Name, byPath["/long/b"].Name
+	if len(a) != 64 || len(b) != 64 || a == b {
+		t.Errorf("Expected distinct truncated names, got %q and %q", a, b)
+	}
+
+	reasons := map[string]string{}
+	for _, r := range renames {
+		reasons[r.Path] = r.Reason
+		if functions[r.Name] == nil || functions[r.Name].OapiPath != r.Path {
+			t.Errorf("Rename %+v does not match a generated function", r)
+		}
+	}
+	want := map[string]string{
+		"/pets/{id}":    "collision",
+		"/pets.json":    "sanitized",
+		"/store/search": "sanitized",
+		"/long/a":       "truncated",
+		"/long/b":       "truncated",
+	}
+	if len(reasons) != len(want) {
+		t.Errorf("Expected %d renames, got %+v", len(want), renames)
+	}
+	for path, reason := range want {
+		if reasons[path] != reason {
+			t.Errorf("%s: expected rename reason %q, got %q", path, reason, reasons[path])
+		}
+	}
+
+	// Path based names ignore operationId
+	functions, err = ConvertOpenAPIToFunctions(spec, WithFunctionNamer(PathNamer))
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	if functions["get_pets"] == nil || functions["get_store_search"] == nil {
+		t.Errorf("Expected path based names, got %v", len(functions))
+	}
+
+	// Custom strategy
+	functions, err = ConvertOpenAPIToFunctions(spec, WithFunctionNamer(FunctionNamerFunc(func(method, path string, op *Operation) string {
+		return "api" + strings.ReplaceAll(path, "/", "-")
+	})))
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	if functions["api-pets"] == nil {
+		t.Errorf("Expected custom names")
+	}
+}
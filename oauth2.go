@@ -0,0 +1,155 @@
+package apiai
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// SetClientCredentials registers the client of an oauth2 scheme with a
+// clientCredentials flow, tokens are requested for the scopes each operation requires
+func (r *CredentialRegistry) SetClientCredentials(name, clientID, clientSecret string) error {
+	return r.Set(name, &AuthConfig{ClientID: clientID, ClientSecret: clientSecret})
+}
+
+// SetRefreshToken registers a refresh token of an oauth2 scheme, e.g. obtained
+// with its authorizationCode flow, access tokens are refreshed from it
+func (r *CredentialRegistry) SetRefreshToken(name, clientID, clientSecret, refreshToken string) error {
+	return r.Set(name, &AuthConfig{ClientID: clientID, ClientSecret: clientSecret, RefreshToken: refreshToken})
+}
+
+// usesOAuth2Flow reports whether the credentials obtain tokens from a flow of the spec
+func usesOAuth2Flow(cred *AuthConfig) bool {
+	return cred.Type == AuthTypeOAuth2 && cred.TokenSource == nil && cred.Token == "" &&
+		(cred.ClientID != "" || cred.RefreshToken != "")
+}
+
+// oauth2Flow returns the flow tokens are obtained with: the first one with
+// a token URL for a refresh token, the clientCredentials flow otherwise
+func oauth2Flow(scheme *SecurityScheme, cred *AuthConfig) (*OAuthFlow, error) {
+	if scheme.Type != "oauth2" || scheme.Flows == nil {
+		return nil, fmt.Errorf("%s scheme declares no oauth2 flows", scheme.Type)
+	}
+	if cred.RefreshToken != "" {
+		for _, flow := range []*OAuthFlow{scheme.Flows.AuthorizationCode, scheme.Flows.Password, scheme.Flows.ClientCredentials} {
+			if flow != nil && flow.TokenURL != "" {
+				return flow, nil
+			}
+		}
+		return nil, fmt.Errorf("oauth2 scheme declares no flow with a tokenUrl")
+	}
+	if flow := scheme.Flows.ClientCredentials; flow != nil && flow.TokenURL != "" {
+		return flow, nil
+	}
+	return nil, fmt.Errorf("oauth2 scheme declares no clientCredentials flow")
+}
+
+// newFlowTokenSource creates a caching token source for the flow and scopes,
+// tokens are requested again or refreshed when they expire
+func newFlowTokenSource(flow *OAuthFlow, cred *AuthConfig, scopes []string) *flowTokenSource {
+	if cred.RefreshToken != "" {
+		tokenURL := flow.TokenURL
+		if flow.RefreshURL != "" {
+			tokenURL = flow.RefreshURL
+		}
+		conf := &oauth2.Config{
+			ClientID:     cred.ClientID,
+			ClientSecret: cred.ClientSecret,
+			Endpoint:     oauth2.Endpoint{AuthURL: flow.AuthorizationURL, TokenURL: tokenURL},
+			Scopes:       scopes,
+		}
+		return &flowTokenSource{fetch: func(ctx context.Context, last *oauth2.Token) (*oauth2.Token, error) {
+			// Rotated refresh tokens replace the registered one
+			refresh := &oauth2.Token{RefreshToken: cred.RefreshToken}
+			if last != nil && last.RefreshToken != "" {
+				refresh = &oauth2.Token{RefreshToken: last.RefreshToken}
+			}
+			return conf.TokenSource(ctx, refresh).Token()
+		}}
+	}
+	conf := &clientcredentials.Config{
+		ClientID:     cred.ClientID,
+		ClientSecret: cred.ClientSecret,
+		TokenURL:     flow.TokenURL,
+		Scopes:       scopes,
+	}
+	return &flowTokenSource{fetch: func(ctx context.Context, _ *oauth2.Token) (*oauth2.Token, error) {
+		return conf.Token(ctx)
+	}}
+}
+
+// contextTokenSource is a token source requesting tokens with the context
+// of the API request, so they follow its deadline and the client transport
+type contextTokenSource interface {
+	TokenContext(ctx context.Context) (*oauth2.Token, error)
+}
+
+// flowTokenSource caches the tokens of an oauth2 flow until they expire
+// or the API rejects them
+type flowTokenSource struct {
+	mu    sync.Mutex
+	fetch func(ctx context.Context, last *oauth2.Token) (*oauth2.Token, error)
+	token *oauth2.Token
+}
+
+// Token implements the oauth2.TokenSource interface.
+func (s *flowTokenSource) Token() (*oauth2.Token, error) {
+	return s.TokenContext(context.Background())
+}
+
+// TokenContext implements the contextTokenSource interface.
+func (s *flowTokenSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token.Valid() {
+		return s.token, nil
+	}
+	token, err := s.fetch(ctx, s.token)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// InvalidateToken implements the TokenInvalidator interface.
+func (s *flowTokenSource) InvalidateToken(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && s.token.AccessToken == accessToken {
+		// Kept expired for its refresh token
+		expired := *s.token
+		expired.Expiry = time.Now().Add(-time.Second)
+		s.token = &expired
+	}
+}
+
+// scopedTokenSource returns the token source of the scheme for the scopes,
+// one is created and cached per scope set
+func (r *CredentialRegistry) scopedTokenSource(name string, cred *AuthConfig, scopes []string) (oauth2.TokenSource, error) {
+	scopes = slices.Compact(slices.Sorted(slices.Values(scopes)))
+	key := name + "\x00" + strings.Join(scopes, " ")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ts, ok := r.tokenSources[key]; ok {
+		return ts, nil
+	}
+	scheme, ok := r.schemes[name]
+	if !ok {
+		return nil, fmt.Errorf("security scheme %q: no oauth2 flows declared", name)
+	}
+	flow, err := oauth2Flow(scheme, cred)
+	if err != nil {
+		return nil, fmt.Errorf("security scheme %q: %w", name, err)
+	}
+	ts := newFlowTokenSource(flow, cred, scopes)
+	r.tokenSources[key] = ts
+	return ts, nil
+}
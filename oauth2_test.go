@@ -0,0 +1,177 @@
+package apiai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOAuth2FlowsFromSpec(t *testing.T) {
+	type tokenRequest struct {
+		grantType, scope, refreshToken, clientID string
+	}
+	var tokenRequests []tokenRequest
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID, _, ok := r.BasicAuth()
+		if !ok {
+			clientID = r.PostForm.Get("client_id")
+		}
+		tr := tokenRequest{r.PostForm.Get("grant_type"), r.PostForm.Get("scope"), r.PostForm.Get("refresh_token"), clientID}
+		tokenRequests = append(tokenRequests, tr)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": fmt.Sprintf("token-%d", len(tokenRequests)),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenSrv.Close()
+
+	var gotAuth string
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{}`))
+	}))
+	defer apiSrv.Close()
+
+	specYAML := strings.ReplaceAll(`
+openapi: 3.0.0
+info:
+  title: OAuth
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      security:
+        - machine: [pets:read]
+    post:
+      operationId: addPet
+      security:
+        - machine: [pets:write, pets:read]
+  /me:
+    get:
+      operationId: me
+      security:
+        - user: [profile]
+components:
+  securitySchemes:
+    machine:
+      type: oauth2
+      flows:
+        clientCredentials:
+          tokenUrl: TOKEN_URL/token
+          scopes:
+            pets:read: Read pets
+            pets:write: Write pets
+    user:
+      type: oauth2
+      flows:
+        authorizationCode:
+          authorizationUrl: TOKEN_URL/authorize
+          tokenUrl: TOKEN_URL/token
+          scopes:
+            profile: Profile
+`, "TOKEN_URL", tokenSrv.URL)
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(specYAML))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	registry, err := NewCredentialRegistry(spec)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if err := registry.SetClientCredentials("machine", "agent", "secret"); err != nil {
+		t.Fatalf("Failed to set client credentials: %v", err)
+	}
+	if err := registry.SetClientCredentials("user", "agent", "secret"); err == nil {
+		t.Errorf("Expected an error without a clientCredentials flow")
+	}
+	if err := registry.SetRefreshToken("user", "agent", "secret", "refresh-1"); err != nil {
+		t.Fatalf("Failed to set refresh token: %v", err)
+	}
+
+	client, err := NewAPIClient(apiSrv.URL, nil, WithCredentialRegistry(registry))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	calls := []struct {
+		function string
+		auth     string
+	}{
+		{"listPets", "Bearer token-1"},
+		{"listPets", "Bearer token-1"}, // cached
+		{"addPet", "Bearer token-2"},   // another scope set
+		{"me", "Bearer token-3"},
+	}
+	for _, c := range calls {
+		if _, err := ExecuteFunction(client, functions[c.function], nil); err != nil {
+			t.Fatalf("%s: failed to execute function: %v", c.function, err)
+		}
+		if gotAuth != c.auth {
+			t.Errorf("%s: expected %q, got %q", c.function, c.auth, gotAuth)
+		}
+	}
+
+	want := []tokenRequest{
+		{"client_credentials", "pets:read", "", "agent"},
+		{"client_credentials", "pets:read pets:write", "", "agent"},
+		{"refresh_token", "", "refresh-1", "agent"},
+	}
+	if fmt.Sprint(tokenRequests) != fmt.Sprint(want) {
+		t.Errorf("Unexpected token requests %v, expected %v", tokenRequests, want)
+	}
+}
+
+func TestOAuth2TokenRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer tokenSrv.Close()
+	defer close(release)
+
+	spec := &OpenAPISpec{Components: &Components{SecuritySchemes: map[string]*SecurityScheme{
+		"machine": {Type: "oauth2", Flows: &OAuthFlows{ClientCredentials: &OAuthFlow{TokenURL: tokenSrv.URL}}},
+	}}}
+	registry, err := NewCredentialRegistry(spec)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if err := registry.SetClientCredentials("machine", "agent", "secret"); err != nil {
+		t.Fatalf("Failed to set client credentials: %v", err)
+	}
+	client, err := NewAPIClient("http://api.invalid", nil, WithCredentialRegistry(registry))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	client.Timeout = 200 * time.Millisecond
+
+	// The token request follows the deadline of the function call
+	fn := &FunctionDefinition{Name: "list", OapiMethod: http.MethodGet, OapiPath: "/items", Security: []SecurityRequirement{{"machine": nil}}}
+	start := time.Now()
+	_, err = ExecuteFunction(client, fn, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the call to return at its deadline, took %v", elapsed)
+	}
+}
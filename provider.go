@@ -0,0 +1,71 @@
+package apiai
+
+import (
+	"context"
+	"net/http"
+)
+
+// CredentialProvider supplies credentials per request, e.g. those of the end user
+// identified in the context, so one client can call APIs on behalf of many users.
+// Credentials is called with the security scheme name required by the operation,
+// or an empty name for functions without declared security. A nil config falls
+// back to the registry, then to the client AuthConfig for schemes the registry
+// does not declare. Type and APIKeyName are taken from the scheme declared in
+// the registry when empty.
+type CredentialProvider interface {
+	Credentials(ctx context.Context, scheme string) (*AuthConfig, error)
+}
+
+// CredentialProviderFunc is a function implementing CredentialProvider
+type CredentialProviderFunc func(ctx context.Context, scheme string) (*AuthConfig, error)
+
+// Credentials implements the CredentialProvider interface.
+func (f CredentialProviderFunc) Credentials(ctx context.Context, scheme string) (*AuthConfig, error) {
+	return f(ctx, scheme)
+}
+
+// WithCredentialProvider makes the client consult the provider with the
+// request context before its registry and AuthConfig
+func WithCredentialProvider(provider CredentialProvider) func(*http.Client) {
+	return func(c *http.Client) {
+		if art, ok := c.Transport.(*AuthRoundTripper); ok {
+			art.provider = provider
+		}
+	}
+}
+
+// credential returns the credentials of the scheme for the request, from the
+// provider first, then from the registry. The client AuthConfig is used for
+// schemes the registry does not declare, or when there is no registry.
+func (art *AuthRoundTripper) credential(ctx context.Context, name string, scopes []string) (*AuthConfig, bool, error) {
+	if art.provider != nil {
+		cred, err := art.provider.Credentials(ctx, name)
+		if err != nil {
+			return nil, false, err
+		}
+		if cred != nil {
+			if art.credentials != nil {
+				if cred, err = art.credentials.withSchemeDefaults(name, cred); err != nil {
+					return nil, false, err
+				}
+			}
+			return cred, true, nil
+		}
+	}
+	if art.credentials != nil {
+		if _, declared := art.credentials.Scheme(name); declared {
+			return art.credentials.credential(name, scopes)
+		}
+		if cred, ok, err := art.credentials.credential(name, scopes); err != nil || ok {
+			return cred, ok, err
+		}
+	}
+
+	art.mu.RLock()
+	config := art.config
+	art.mu.RUnlock()
+	if config == nil || config.Type == AuthTypeNone {
+		return nil, false, nil
+	}
+	return config, true, nil
+}
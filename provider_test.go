@@ -0,0 +1,146 @@
+package apiai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type userKey struct{}
+
+func TestCredentialProvider(t *testing.T) {
+	var gotAuth, gotKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotKey = r.Header.Get("X-API-Key")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(securitySpec))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	registry, err := NewCredentialRegistry(spec)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if err := registry.SetAPIKey("apiKey", "shared"); err != nil {
+		t.Fatalf("Failed to set api key: %v", err)
+	}
+
+	errNoUser := errors.New("no user in context")
+	tokens := map[string]string{"alice": "token-a", "bob": "token-b"}
+	provider := CredentialProviderFunc(func(ctx context.Context, scheme string) (*AuthConfig, error) {
+		user, _ := ctx.Value(userKey{}).(string)
+		switch scheme {
+		case "":
+			if user == "" {
+				return nil, nil
+			}
+			return &AuthConfig{Type: AuthTypeBearer, Token: tokens[user]}, nil
+		case "bearer":
+			if user == "" {
+				return nil, errNoUser
+			}
+			return &AuthConfig{Token: tokens[user]}, nil
+		}
+		return nil, nil
+	})
+
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeBearer, Token: "service"},
+		WithCredentialRegistry(registry), WithCredentialProvider(provider))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	plain := &FunctionDefinition{Name: "plain", OapiMethod: http.MethodGet, OapiPath: "/plain"}
+
+	tests := []struct {
+		user string
+		fn   *FunctionDefinition
+		auth string
+		key  string
+	}{
+		{"alice", functions["either"], "Bearer token-a", ""},
+		{"bob", functions["either"], "Bearer token-b", ""},
+		{"bob", functions["defaultSecurity"], "", "shared"}, // falls back to the registry
+		{"alice", plain, "Bearer token-a", ""},
+		{"", plain, "Bearer service", ""}, // falls back to the client config
+	}
+	for _, tt := range tests {
+		ctx := context.WithValue(context.Background(), userKey{}, tt.user)
+		if _, err := ExecuteFunctionContext(ctx, client, tt.fn, nil); err != nil {
+			t.Fatalf("%s as %q: failed to execute function: %v", tt.fn.Name, tt.user, err)
+		}
+		if gotAuth != tt.auth || gotKey != tt.key {
+			t.Errorf("%s as %q: expected %q/%q, got %q/%q", tt.fn.Name, tt.user, tt.auth, tt.key, gotAuth, gotKey)
+		}
+	}
+
+	if _, err := ExecuteFunction(client, functions["either"], nil); !errors.Is(err, errNoUser) {
+		t.Errorf("Expected the provider error, got %v", err)
+	}
+}
+
+func TestCredentialProviderWithoutRegistry(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	provider := CredentialProviderFunc(func(ctx context.Context, scheme string) (*AuthConfig, error) {
+		if user, _ := ctx.Value(userKey{}).(string); user != "" {
+			return &AuthConfig{Type: AuthTypeBearer, Token: "token-" + user}, nil
+		}
+		return nil, nil
+	})
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeBearer, Token: "service"}, WithCredentialProvider(provider))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	fn := &FunctionDefinition{Name: "list", OapiMethod: http.MethodGet, OapiPath: "/items", Security: []SecurityRequirement{{"bearer": nil}}}
+
+	for user, want := range map[string]string{"alice": "Bearer token-alice", "": "Bearer service"} {
+		ctx := context.WithValue(context.Background(), userKey{}, user)
+		if _, err := ExecuteFunctionContext(ctx, client, fn, nil); err != nil {
+			t.Fatalf("As %q: failed to execute function: %v", user, err)
+		}
+		if gotAuth != want {
+			t.Errorf("As %q: expected %q, got %q", user, want, gotAuth)
+		}
+	}
+}
+
+func TestCredentialProviderFallbackOnce(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	provider := CredentialProviderFunc(func(context.Context, string) (*AuthConfig, error) {
+		return nil, nil
+	})
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeAPIKeyQuery, APIKeyName: "key", APIKeyValue: "k"}, WithCredentialProvider(provider))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	// Both schemes fall back to the client config, it is applied once
+	fn := &FunctionDefinition{Name: "list", OapiMethod: http.MethodGet, OapiPath: "/items", Security: []SecurityRequirement{{"a": nil, "b": nil}}}
+	if _, err := ExecuteFunction(client, fn, nil); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	if gotQuery != "key=k" {
+		t.Errorf("Expected the key once, got %q", gotQuery)
+	}
+}
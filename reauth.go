@@ -0,0 +1,152 @@
+package apiai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// maxDrainLength limits the 401 response body read before a replay,
+// so the connection can be reused
+const maxDrainLength = 64 << 10
+
+// TokenInvalidator is implemented by token sources that can drop a token the
+// API rejected, so the next Token call obtains a fresh one. The token sources
+// of the spec oauth2 flows implement it.
+type TokenInvalidator interface {
+	InvalidateToken(accessToken string)
+}
+
+// WithReplayMutatingRequests lets the client replay POST and PATCH requests
+// after renewing credentials the API rejected with 401. By default only
+// requests with idempotent methods are replayed, others return the 401
+// response and the renewed credentials apply to the next call.
+func WithReplayMutatingRequests() func(*http.Client) {
+	return func(c *http.Client) {
+		if art, ok := c.Transport.(*AuthRoundTripper); ok {
+			art.replayMutating = true
+		}
+	}
+}
+
+// reauthenticate renews the credentials rejected with the 401 response and
+// replays the request once with them, when it can be replayed
+func (art *AuthRoundTripper) reauthenticate(req *http.Request, resp *http.Response, configs []*AuthConfig) (*http.Response, error) {
+	renewed, ok, err := art.renew(req.Context(), resp.Request, configs)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if !ok || !art.replayable(req) {
+		return resp, nil
+	}
+
+	replay := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if replay.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	io.CopyN(io.Discard, resp.Body, maxDrainLength)
+	resp.Body.Close()
+	return art.send(replay, renewed)
+}
+
+// renew obtains fresh credentials for those sent with the rejected request,
+// it reports whether any of them changed
+func (art *AuthRoundTripper) renew(ctx context.Context, rejected *http.Request, configs []*AuthConfig) ([]*AuthConfig, bool, error) {
+	renewed := slices.Clone(configs)
+	changed := false
+	for i, config := range configs {
+		if config.Reauthenticate != nil {
+			fresh, err := config.Reauthenticate(ctx, config)
+			if err != nil {
+				return nil, false, fmt.Errorf("reauthenticating: %w", err)
+			}
+			if fresh == nil {
+				continue
+			}
+			if fresh.Reauthenticate == nil {
+				cp := *fresh
+				cp.Reauthenticate = config.Reauthenticate
+				fresh = &cp
+			}
+			if fresh, err = art.replace(config, fresh); err != nil {
+				return nil, false, err
+			}
+			renewed[i] = fresh
+			changed = true
+			continue
+		}
+		if config.Type == AuthTypeOAuth2 {
+			if inv, ok := config.TokenSource.(TokenInvalidator); ok {
+				_, token, _ := strings.Cut(rejected.Header.Get("Authorization"), " ")
+				inv.InvalidateToken(token)
+				changed = true
+			}
+		}
+	}
+	return renewed, changed, nil
+}
+
+// replace stores the renewed credentials where the rejected ones came from:
+// the client config or the registry. Provider credentials are not stored,
+// the provider is expected to supply the renewed ones. It returns the
+// credentials to replay the request with.
+func (art *AuthRoundTripper) replace(rejected, renewed *AuthConfig) (*AuthConfig, error) {
+	art.mu.Lock()
+	if art.config == rejected {
+		art.config = renewed
+	}
+	art.mu.Unlock()
+	if art.credentials != nil {
+		return art.credentials.replace(rejected, renewed)
+	}
+	return renewed, nil
+}
+
+// replayable reports whether the request can be sent again: its body can be
+// recreated and its method is idempotent, or mutating replays are enabled
+func (art *AuthRoundTripper) replayable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodPost, http.MethodPatch:
+		return art.replayMutating
+	}
+	return true
+}
+
+// replace swaps credentials the API rejected, or the scoped copy of them
+// that was sent, for the renewed ones. It returns the renewed credentials
+// as the registry resolves them for the scopes of the rejected request.
+func (r *CredentialRegistry) replace(rejected, renewed *AuthConfig) (*AuthConfig, error) {
+	r.mu.Lock()
+	var name string
+	for n, cred := range r.credentials {
+		if cred == rejected || cred == rejected.registered {
+			name = n
+			break
+		}
+	}
+	if name == "" {
+		r.mu.Unlock()
+		return renewed, nil
+	}
+	fresh := *renewed
+	fresh.registered, fresh.scopes = nil, nil
+	if scheme, ok := r.schemes[name]; ok {
+		// The scheme was validated when the rejected credentials were set
+		applySchemeDefaults(scheme, &fresh)
+	}
+	r.credentials[name] = &fresh
+	r.dropTokenSources(name)
+	r.mu.Unlock()
+
+	cred, _, err := r.credential(name, rejected.scopes)
+	return cred, err
+}
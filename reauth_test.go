@@ -0,0 +1,217 @@
+package apiai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReauthenticateOnUnauthorized(t *testing.T) {
+	var valid = "Bearer fresh"
+	var gotBodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBodies = append(gotBodies, r.Method+" "+string(body))
+		if r.Header.Get("Authorization") != valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	logins := 0
+	login := func(ctx context.Context, rejected *AuthConfig) (*AuthConfig, error) {
+		logins++
+		return &AuthConfig{Type: AuthTypeBearer, Token: "fresh"}, nil
+	}
+	newClient := func(opts ...func(*http.Client)) *APIClient {
+		client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeBearer, Token: "stale", Reauthenticate: login}, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		return client
+	}
+	get := &FunctionDefinition{Name: "get", OapiMethod: http.MethodGet, OapiPath: "/items"}
+	post := &FunctionDefinition{Name: "post", OapiMethod: http.MethodPost, OapiPath: "/items"}
+	put := &FunctionDefinition{Name: "put", OapiMethod: http.MethodPut, OapiPath: "/items", RequestContentType: "application/octet-stream"}
+
+	// Idempotent requests are replayed once, the renewed token is kept
+	client := newClient()
+	if _, err := ExecuteFunction(client, get, nil); err != nil {
+		t.Fatalf("Expected the replay to succeed, got %v", err)
+	}
+	if _, err := ExecuteFunction(client, get, nil); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	if logins != 1 || len(gotBodies) != 3 {
+		t.Errorf("Expected 1 login and 3 requests, got %d and %q", logins, gotBodies)
+	}
+
+	// Mutating requests are not replayed by default, the next call succeeds
+	client, logins, gotBodies = newClient(), 0, nil
+	args := map[string]any{"requestBody": map[string]any{"name": "Rex"}}
+	_, err := ExecuteFunction(client, post, args)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without replay, got %v", err)
+	}
+	if _, err := ExecuteFunction(client, post, args); err != nil {
+		t.Fatalf("Expected the renewed token to be used, got %v", err)
+	}
+	if logins != 1 || len(gotBodies) != 2 {
+		t.Errorf("Expected 1 login and 2 requests, got %d and %q", logins, gotBodies)
+	}
+
+	// Unless enabled, the body is sent again
+	client, logins, gotBodies = newClient(WithReplayMutatingRequests()), 0, nil
+	if _, err := ExecuteFunction(client, post, args); err != nil {
+		t.Fatalf("Expected the replay to succeed, got %v", err)
+	}
+	want := []string{`POST {"name":"Rex"}`, `POST {"name":"Rex"}`}
+	if fmt.Sprint(gotBodies) != fmt.Sprint(want) {
+		t.Errorf("Expected requests %q, got %q", want, gotBodies)
+	}
+
+	// Streamed bodies can not be replayed
+	client, logins, gotBodies = newClient(), 0, nil
+	stream := FilePart{Content: io.MultiReader(strings.NewReader("data"))}
+	if _, err := ExecuteFunction(client, put, map[string]any{"requestBody": stream}); !errors.As(err, &apiErr) {
+		t.Errorf("Expected 401 for a streamed body, got %v", err)
+	}
+	if logins != 1 || len(gotBodies) != 1 {
+		t.Errorf("Expected 1 login and 1 request, got %d and %q", logins, gotBodies)
+	}
+
+	// The request is replayed only once
+	client, logins, gotBodies = newClient(), 0, nil
+	valid = "Bearer never"
+	if _, err := ExecuteFunction(client, get, nil); !errors.As(err, &apiErr) {
+		t.Errorf("Expected 401 after the replay, got %v", err)
+	}
+	if logins != 1 || len(gotBodies) != 2 {
+		t.Errorf("Expected 1 login and 2 requests, got %d and %q", logins, gotBodies)
+	}
+
+	// Login failures are returned
+	client, err = NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeBearer, Token: "stale",
+		Reauthenticate: func(context.Context, *AuthConfig) (*AuthConfig, error) {
+			return nil, errors.New("invalid password")
+		}})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if _, err := ExecuteFunction(client, get, nil); err == nil || !strings.Contains(err.Error(), "reauthenticating: invalid password") {
+		t.Errorf("Expected the login error, got %v", err)
+	}
+}
+
+func TestReauthenticateOAuth2Flow(t *testing.T) {
+	issued := 0
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issued++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": fmt.Sprintf("token-%d", issued),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenSrv.Close()
+
+	// The first token is revoked before it expires
+	var gotAuth []string
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer apiSrv.Close()
+
+	spec := &OpenAPISpec{Components: &Components{SecuritySchemes: map[string]*SecurityScheme{
+		"machine": {Type: "oauth2", Flows: &OAuthFlows{ClientCredentials: &OAuthFlow{TokenURL: tokenSrv.URL}}},
+	}}}
+	registry, err := NewCredentialRegistry(spec)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if err := registry.SetClientCredentials("machine", "agent", "secret"); err != nil {
+		t.Fatalf("Failed to set client credentials: %v", err)
+	}
+	client, err := NewAPIClient(apiSrv.URL, nil, WithCredentialRegistry(registry))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	fn := &FunctionDefinition{Name: "list", OapiMethod: http.MethodGet, OapiPath: "/items", Security: []SecurityRequirement{{"machine": nil}}}
+	for range 2 {
+		if _, err := ExecuteFunction(client, fn, nil); err != nil {
+			t.Fatalf("Failed to execute function: %v", err)
+		}
+	}
+	want := []string{"Bearer token-1", "Bearer token-2", "Bearer token-2"}
+	if fmt.Sprint(gotAuth) != fmt.Sprint(want) || issued != 2 {
+		t.Errorf("Expected requests with %q, got %q and %d tokens", want, gotAuth, issued)
+	}
+}
+
+func TestReauthenticateOAuth2FlowKeepsRenewed(t *testing.T) {
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "flow", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer tokenSrv.Close()
+
+	var gotAuth []string
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer apiSrv.Close()
+
+	spec := &OpenAPISpec{Components: &Components{SecuritySchemes: map[string]*SecurityScheme{
+		"machine": {Type: "oauth2", Flows: &OAuthFlows{ClientCredentials: &OAuthFlow{TokenURL: tokenSrv.URL}}},
+	}}}
+	registry, err := NewCredentialRegistry(spec)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	logins := 0
+	err = registry.Set("machine", &AuthConfig{ClientID: "agent", ClientSecret: "secret",
+		Reauthenticate: func(context.Context, *AuthConfig) (*AuthConfig, error) {
+			logins++
+			return &AuthConfig{Token: "fresh"}, nil
+		}})
+	if err != nil {
+		t.Fatalf("Failed to set credentials: %v", err)
+	}
+	client, err := NewAPIClient(apiSrv.URL, nil, WithCredentialRegistry(registry))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	// The renewed credentials replace the flow for the next calls
+	fn := &FunctionDefinition{Name: "list", OapiMethod: http.MethodGet, OapiPath: "/items", Security: []SecurityRequirement{{"machine": nil}}}
+	for range 2 {
+		if _, err := ExecuteFunction(client, fn, nil); err != nil {
+			t.Fatalf("Failed to execute function: %v", err)
+		}
+	}
+	want := []string{"Bearer flow", "Bearer fresh", "Bearer fresh"}
+	if fmt.Sprint(gotAuth) != fmt.Sprint(want) || logins != 1 {
+		t.Errorf("Expected requests with %q and 1 login, got %q and %d", want, gotAuth, logins)
+	}
+}
@@ -0,0 +1,212 @@
+package apiai
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// parseRefPointer splits a local reference ("#/components/schemas/Pet") into
+// unescaped JSON Pointer tokens (RFC 6901)
+func parseRefPointer(ref string) ([]string, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported external $ref %q", ref)
+	}
+
+	fragment, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref %q: %w", ref, err)
+	}
+	if fragment == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(fragment, "/") {
+		return nil, fmt.Errorf("invalid $ref %q: pointer must start with '/'", ref)
+	}
+
+	tokens := strings.Split(fragment[1:], "/")
+	for i, token := range tokens {
+		// "~1" must be replaced before "~0", so "~01" becomes "~1" and not "/"
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens, nil
+}
+
+// resolvePointer walks the spec model following a local JSON Pointer.
+// Struct fields are matched by their json names, so any location of the
+// document can be addressed, e.g. "#/paths/~1pets/get/parameters/0".
+func resolvePointer(spec *OpenAPISpec, ref string) (reflect.Value, error) {
+	tokens, err := parseRefPointer(ref)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	v := reflect.ValueOf(spec)
+	for _, token := range tokens {
+		v = indirectValue(v)
+		if !v.IsValid() {
+			return reflect.Value{}, fmt.Errorf("unresolved $ref %q: %q not found", ref, token)
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			v = fieldByJSONName(v, token)
+
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, fmt.Errorf("unresolved $ref %q: %q not found", ref, token)
+			}
+			v = v.MapIndex(reflect.ValueOf(token).Convert(v.Type().Key()))
+
+		case reflect.Slice, reflect.Array:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= v.Len() {
+				return reflect.Value{}, fmt.Errorf("unresolved $ref %q: invalid index %q", ref, token)
+			}
+			v = v.Index(idx)
+
+		default:
+			v = reflect.Value{}
+		}
+
+		if !v.IsValid() {
+			return reflect.Value{}, fmt.Errorf("unresolved $ref %q: %q not found", ref, token)
+		}
+	}
+
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return reflect.Value{}, fmt.Errorf("unresolved $ref %q: empty target", ref)
+	}
+	return v, nil
+}
+
+// indirectValue dereferences pointers and interfaces, returning an invalid value for nil
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// fieldByJSONName returns the struct field whose json tag name equals name
+func fieldByJSONName(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = field.Name
+		}
+		if tag == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// resolveRef resolves a single local reference to a value of type T
+func resolveRef[T any](spec *OpenAPISpec, ref string) (*T, error) {
+	v, err := resolvePointer(spec, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	target, ok := v.Interface().(T)
+	if !ok {
+		var zero T
+		return nil, fmt.Errorf("$ref %q points to %s, expected %T", ref, v.Type(), zero)
+	}
+	return &target, nil
+}
+
+// followRefs resolves ref and any chained references of the target, e.g. a
+// components.parameters entry that is itself a $ref
+func followRefs[T any](spec *OpenAPISpec, ref string, refOf func(*T) string) (*T, error) {
+	seen := map[string]bool{}
+	for {
+		if seen[ref] {
+			return nil, fmt.Errorf("circular $ref %q", ref)
+		}
+		seen[ref] = true
+
+		target, err := resolveRef[T](spec, ref)
+		if err != nil {
+			return nil, err
+		}
+		next := refOf(target)
+		if next == "" {
+			return target, nil
+		}
+		ref = next
+	}
+}
+
+// resolveParameterRef resolves a $ref parameter to its actual definition
+func resolveParameterRef(param Parameter, spec *OpenAPISpec) (Parameter, error) {
+	if param.Ref == "" {
+		return param, nil
+	}
+	resolved, err := followRefs(spec, param.Ref, func(p *Parameter) string { return p.Ref })
+	if err != nil {
+		return param, err
+	}
+	return *resolved, nil
+}
+
+// resolveSchemaRef resolves a $ref schema, e.g. "#/components/schemas/Pet", to its definition
+func resolveSchemaRef(ref string, spec *OpenAPISpec) (*Schema, error) {
+	return followRefs(spec, ref, func(s *Schema) string { return s.Ref })
+}
+
+// resolveRequestBodyRef resolves a $ref request body to its actual definition
+func resolveRequestBodyRef(body *RequestBody, spec *OpenAPISpec) (*RequestBody, error) {
+	if body == nil || body.Ref == "" {
+		return body, nil
+	}
+	return followRefs(spec, body.Ref, func(b *RequestBody) string { return b.Ref })
+}
+
+// resolveResponseRef resolves a $ref response to its actual definition
+func resolveResponseRef(resp *Response, spec *OpenAPISpec) (*Response, error) {
+	if resp == nil || resp.Ref == "" {
+		return resp, nil
+	}
+	return followRefs(spec, resp.Ref, func(r *Response) string { return r.Ref })
+}
+
+// resolveHeaderRef resolves a $ref header to its actual definition
+func resolveHeaderRef(header *Header, spec *OpenAPISpec) (*Header, error) {
+	if header == nil || header.Ref == "" {
+		return header, nil
+	}
+	return followRefs(spec, header.Ref, func(h *Header) string { return h.Ref })
+}
+
+// resolveExampleRef resolves a $ref example to its actual definition
+func resolveExampleRef(example *Example, spec *OpenAPISpec) (*Example, error) {
+	if example == nil || example.Ref == "" {
+		return example, nil
+	}
+	return followRefs(spec, example.Ref, func(e *Example) string { return e.Ref })
+}
+
+// resolveSecuritySchemeRef resolves a $ref security scheme to its actual definition
+func resolveSecuritySchemeRef(scheme *SecurityScheme, spec *OpenAPISpec) (*SecurityScheme, error) {
+	if scheme == nil || scheme.Ref == "" {
+		return scheme, nil
+	}
+	return followRefs(spec, scheme.Ref, func(s *SecurityScheme) string { return s.Ref })
+}
@@ -0,0 +1,183 @@
+package apiai
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRefPointer(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    []string
+		wantErr bool
+	}{
+		{ref: "#", want: nil},
+		{ref: "#/components/schemas/Pet", want: []string{"components", "schemas", "Pet"}},
+		{ref: "#/paths/~1pets~1{id}/get", want: []string{"paths", "/pets/{id}", "get"}},
+		{ref: "#/components/schemas/a~0b", want: []string{"components", "schemas", "a~b"}},
+		{ref: "#/components/schemas/a~01", want: []string{"components", "schemas", "a~1"}},
+		{ref: "#/components/schemas/My%20Pet", want: []string{"components", "schemas", "My Pet"}},
+		{ref: "other.yaml#/Pet", wantErr: true},
+		{ref: "#components", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRefPointer(tt.ref)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseRefPointer(%q): expected error", tt.ref)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRefPointer(%q): unexpected error: %v", tt.ref, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRefPointer(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestResolveComponentRefs(t *testing.T) {
+	specJSON := `{
+		"openapi": "3.0.0",
+		"info": {"title": "Refs", "version": "1.0.0"},
+		"components": {
+			"schemas": {
+				"Pet": {"type": "object", "properties": {"name": {"type": "string"}}}
+			},
+			"requestBodies": {
+				"PetBody": {
+					"description": "Pet to add",
+					"required": true,
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}
+				},
+				"AliasBody": {"$ref": "#/components/requestBodies/PetBody"}
+			},
+			"responses": {
+				"NotFound": {
+					"description": "Not found",
+					"headers": {"X-Request-ID": {"$ref": "#/components/headers/RequestID"}}
+				}
+			},
+			"headers": {
+				"RequestID": {"description": "Request identifier", "schema": {"type": "string"}}
+			},
+			"examples": {
+				"Cat": {"summary": "A cat", "value": {"name": "Tom"}}
+			},
+			"securitySchemes": {
+				"ApiKey": {"type": "apiKey", "name": "X-API-Key", "in": "header"}
+			},
+			"parameters": {
+				"Loop": {"$ref": "#/components/parameters/Loop"}
+			}
+		},
+		"paths": {
+			"/pets": {
+				"post": {
+					"summary": "Add a pet",
+					"requestBody": {"$ref": "#/components/requestBodies/AliasBody"}
+				}
+			}
+		}
+	}`
+
+	spec, err := UnmarshalOpenAPISpecFromJSON([]byte(specJSON))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal test spec: %v", err)
+	}
+
+	body, err := resolveRequestBodyRef(&RequestBody{Ref: "#/components/requestBodies/AliasBody"}, spec)
+	if err != nil {
+		t.Fatalf("Failed to resolve request body: %v", err)
+	}
+	if body.Description != "Pet to add" || !body.Required {
+		t.Errorf("Unexpected request body: %+v", body)
+	}
+
+	resp, err := resolveResponseRef(&Response{Ref: "#/components/responses/NotFound"}, spec)
+	if err != nil {
+		t.Fatalf("Failed to resolve response: %v", err)
+	}
+	header, err := resolveHeaderRef(resp.Headers["X-Request-ID"], spec)
+	if err != nil {
+		t.Fatalf("Failed to resolve header: %v", err)
+	}
+	if header.Description != "Request identifier" {
+		t.Errorf("Unexpected header: %+v", header)
+	}
+
+	example, err := resolveExampleRef(&Example{Ref: "#/components/examples/Cat"}, spec)
+	if err != nil {
+		t.Fatalf("Failed to resolve example: %v", err)
+	}
+	if example.Summary != "A cat" {
+		t.Errorf("Unexpected example: %+v", example)
+	}
+
+	scheme, err := resolveSecuritySchemeRef(&SecurityScheme{Ref: "#/components/securitySchemes/ApiKey"}, spec)
+	if err != nil {
+		t.Fatalf("Failed to resolve security scheme: %v", err)
+	}
+	if scheme.Name != "X-API-Key" || scheme.In != "header" {
+		t.Errorf("Unexpected security scheme: %+v", scheme)
+	}
+
+	// Pointers are not limited to component names
+	nameSchema, err := resolveSchemaRef("#/components/schemas/Pet/properties/name", spec)
+	if err != nil {
+		t.Fatalf("Failed to resolve nested schema: %v", err)
+	}
+	if nameSchema.Type != "string" {
+		t.Errorf("Expected nested schema type 'string', got '%s'", nameSchema.Type)
+	}
+	op, err := resolveRef[Operation](spec, "#/paths/~1pets/post")
+	if err != nil {
+		t.Fatalf("Failed to resolve operation: %v", err)
+	}
+	if op.Summary != "Add a pet" {
+		t.Errorf("Unexpected operation: %+v", op)
+	}
+
+	// Wrong target type, missing target and circular chains are errors
+	if _, err := resolveSchemaRef("#/components/responses/NotFound", spec); err == nil {
+		t.Errorf("Expected error for a ref pointing to a response")
+	}
+	if _, err := resolveHeaderRef(&Header{Ref: "#/components/headers/Missing"}, spec); err == nil {
+		t.Errorf("Expected error for a missing header")
+	}
+	_, err = resolveParameterRef(Parameter{Ref: "#/components/parameters/Loop"}, spec)
+	if err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Errorf("Expected circular ref error, got %v", err)
+	}
+
+	// Conversion follows the request body chain
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	reqBody := functions["post_pets"].Parameters.Properties["requestBody"]
+	if reqBody == nil || reqBody.Properties["name"] == nil {
+		t.Errorf("Expected request body to be resolved, got %+v", reqBody)
+	}
+}
+
+func TestConvertOpenAPIToFunctionsUnresolvedRef(t *testing.T) {
+	spec := &OpenAPISpec{
+		OpenAPI: "3.0.0",
+		Paths: map[string]PathItem{
+			"/pets": {
+				Get: &Operation{
+					Parameters: []Parameter{{Ref: "#/components/parameters/missing"}},
+				},
+			},
+		},
+	}
+
+	if _, err := ConvertOpenAPIToFunctions(spec); err == nil {
+		t.Errorf("Expected error for unresolved parameter ref")
+	}
+}
@@ -0,0 +1,238 @@
+package apiai
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxErrorBodyLength limits the response body quoted in APIError messages
+const maxErrorBodyLength = 1024
+
+// APIResponse is the result of an API call
+type APIResponse struct {
+	StatusCode  int
+	Header      http.Header
+	ContentType string
+
+	// Body is the decoded JSON body, nil for empty and non-JSON bodies
+	Body any
+	// Text is the raw body when it is not JSON
+	Text string
+}
+
+// Content returns the response body as text suitable for a tool message
+func (r *APIResponse) Content() string {
+	if r.Body != nil {
+		data, err := json.Marshal(r.Body)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return r.Text
+}
+
+// APIError is returned when the API responds with a non-2xx status.
+// Its message includes the status and the response body, so it can be
+// passed back to the model.
+type APIError struct {
+	Method   string
+	Path     string // path template of the operation
+	Response *APIResponse
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.Response.StatusCode, http.StatusText(e.Response.StatusCode))
+	if content := e.Response.Content(); content != "" {
+		if len(content) > maxErrorBodyLength {
+			content = content[:maxErrorBodyLength] + "..."
+		}
+		msg += ": " + content
+	}
+	return msg
+}
+
+// readAPIResponse reads the response, decoding JSON bodies
+func readAPIResponse(resp *http.Response) (*APIResponse, error) {
+	result := &APIResponse{
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if len(data) == 0 {
+		return result, nil
+	}
+
+	// A missing content type is tried as JSON
+	if result.ContentType == "" || bodyKind(result.ContentType) == bodyJSON {
+		var body any
+		if err := json.Unmarshal(data, &body); err == nil {
+			result.Body = body
+			return result, nil
+		}
+	}
+	result.Text = string(data)
+	return result, nil
+}
+
+// maxReturnsHintLength limits the "returns:" hint appended to descriptions
+const maxReturnsHintLength = 200
+
+// FunctionResponse is a documented response of the operation,
+// its schema is converted like the function parameters
+type FunctionResponse struct {
+	Description string
+	ContentType string  // selected media type, empty without content
+	Schema      *Schema // nil when the response has no body schema
+}
+
+// WithReturnsHint appends a compact "returns:" summary of the success
+// response schema to function descriptions
+func WithReturnsHint() ConvertOption {
+	return func(o *convertOptions) {
+		o.returnsHint = true
+	}
+}
+
+// convertResponses resolves and converts the responses of an operation,
+// status code ranges are normalized to upper case, e.g. "2XX"
+func convertResponses(responses map[string]*Response, spec *OpenAPISpec, conv *schemaConverter) (map[string]*FunctionResponse, error) {
+	result := make(map[string]*FunctionResponse, len(responses))
+	for _, code := range slices.Sorted(maps.Keys(responses)) {
+		resp, err := resolveResponseRef(responses[code], spec)
+		if err != nil {
+			return nil, fmt.Errorf("response %s: %w", code, err)
+		}
+		if resp == nil {
+			continue
+		}
+
+		fr := &FunctionResponse{Description: resp.Description}
+		if contentType, ok := selectMediaType(resp.Content, nil); ok {
+			fr.ContentType = contentType
+			if schema := resp.Content[contentType].Schema; schema != nil {
+				if fr.Schema, err = conv.convertSchemaToProperty(schema); err != nil {
+					return nil, fmt.Errorf("response %s: %w", code, err)
+				}
+			}
+		}
+
+		if !strings.EqualFold(code, "default") {
+			code = strings.ToUpper(code)
+		}
+		result[code] = fr
+	}
+	return result, nil
+}
+
+// Response returns the response documented for the status code, matching
+// the exact code first, then its range like "2XX", then "default"
+func (fn *FunctionDefinition) Response(statusCode int) *FunctionResponse {
+	code := strconv.Itoa(statusCode)
+	if r, ok := fn.Responses[code]; ok {
+		return r
+	}
+	if r, ok := fn.Responses[code[:1]+"XX"]; ok {
+		return r
+	}
+	return fn.Responses["default"]
+}
+
+// successResponse returns the lowest documented 2xx response,
+// falling back to "2XX" and "default"
+func (fn *FunctionDefinition) successResponse() *FunctionResponse {
+	for _, code := range slices.Sorted(maps.Keys(fn.Responses)) {
+		if len(code) == 3 && code[0] == '2' && code[1] != 'X' {
+			return fn.Responses[code]
+		}
+	}
+	if r, ok := fn.Responses["2XX"]; ok {
+		return r
+	}
+	return fn.Responses["default"]
+}
+
+// returnsHint summarizes the success response schema, e.g. "{id: integer, tags: string[]}"
+func (fn *FunctionDefinition) returnsHint() string {
+	r := fn.successResponse()
+	if r == nil || r.Schema == nil {
+		return ""
+	}
+	hint := summarizeSchema(r.Schema, 2)
+	if len(hint) > maxReturnsHintLength {
+		hint = hint[:maxReturnsHintLength-3] + "..."
+	}
+	return hint
+}
+
+// summarizeSchema renders a compact type expression, nested objects
+// deeper than depth are shown as "object"
+func summarizeSchema(schema *Schema, depth int) string {
+	if schema == nil {
+		return "any"
+	}
+
+	summarize := func(schemas []*Schema, sep string) string {
+		parts := make([]string, 0, len(schemas))
+		for _, s := range schemas {
+			parts = append(parts, summarizeSchema(s, depth))
+		}
+		return strings.Join(parts, sep)
+	}
+	switch {
+	case len(schema.OneOf) > 0:
+		return summarize(schema.OneOf, " | ")
+	case len(schema.AnyOf) > 0:
+		return summarize(schema.AnyOf, " | ")
+	case len(schema.AllOf) > 0 && len(schema.Properties) == 0:
+		return summarize(schema.AllOf, " & ")
+	}
+
+	switch {
+	case schema.Type == "array":
+		item := summarizeSchema(schema.Items, depth)
+		if strings.ContainsAny(item, " |&") && !strings.HasPrefix(item, "{") {
+			item = "(" + item + ")"
+		}
+		return item + "[]"
+	case schema.Type == "object" || len(schema.Properties) > 0:
+		if depth == 0 || len(schema.Properties) == 0 {
+			return "object"
+		}
+		parts := make([]string, 0, len(schema.Properties))
+		for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+			parts = append(parts, name+": "+summarizeSchema(schema.Properties[name], depth-1))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case schema.Type != "":
+		return schema.Type
+	}
+	return "any"
+}
+
+// ValidateResponse checks the decoded JSON body of the response against the
+// schema documented for its status code, violations are returned as *ValidationError
+func ValidateResponse(fn *FunctionDefinition, resp *APIResponse) error {
+	r := fn.Response(resp.StatusCode)
+	if r == nil || r.Schema == nil || resp.Body == nil {
+		return nil
+	}
+
+	v := &validator{}
+	v.validate(r.Schema, resp.Body, "")
+	if len(v.violations) > 0 {
+		return &ValidationError{Function: fn.Name, StatusCode: resp.StatusCode, Violations: v.violations}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package apiai
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExecuteFunctionResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.Write([]byte(`{"ok":true}`))
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/text":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Write([]byte("a,b\n1,2\n"))
+		case "/untyped":
+			w.Header()["Content-Type"] = nil
+			w.Write([]byte(`[1,2]`))
+		case "/missing":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<html>Not here</html>"))
+		case "/broken":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"database is down"}`))
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	call := func(path string) (*APIResponse, error) {
+		return ExecuteFunction(client, &FunctionDefinition{Name: "call", OapiMethod: http.MethodGet, OapiPath: path}, nil)
+	}
+
+	resp, err := call("/json")
+	if err != nil {
+		t.Fatalf("Failed to call /json: %v", err)
+	}
+	if m, ok := resp.Body.(map[string]any); !ok || m["ok"] != true || resp.ContentType != "application/problem+json" {
+		t.Errorf("Unexpected JSON response %+v", resp)
+	}
+	if resp.Content() != `{"ok":true}` {
+		t.Errorf("Unexpected content %q", resp.Content())
+	}
+
+	resp, err = call("/empty")
+	if err != nil {
+		t.Fatalf("Expected 204 to succeed, got %v", err)
+	}
+	if resp.StatusCode != http.StatusNoContent || resp.Body != nil || resp.Text != "" {
+		t.Errorf("Unexpected empty response %+v", resp)
+	}
+
+	resp, err = call("/text")
+	if err != nil || resp.Body != nil || resp.Text != "a,b\n1,2\n" {
+		t.Errorf("Unexpected text response %+v, %v", resp, err)
+	}
+
+	resp, err = call("/untyped")
+	if err != nil {
+		t.Fatalf("Failed to call /untyped: %v", err)
+	}
+	if items, ok := resp.Body.([]any); !ok || len(items) != 2 {
+		t.Errorf("Expected untyped JSON to be decoded, got %+v", resp)
+	}
+
+	_, err = call("/missing")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+	if apiErr.Response.StatusCode != http.StatusNotFound || apiErr.Response.Text != "<html>Not here</html>" {
+		t.Errorf("Unexpected 404 error %+v", apiErr.Response)
+	}
+
+	_, err = call("/broken")
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+	if m, ok := apiErr.Response.Body.(map[string]any); !ok || m["error"] != "database is down" {
+		t.Errorf("Unexpected 500 error body %+v", apiErr.Response)
+	}
+	if !strings.Contains(err.Error(), "500 Internal Server Error") || !strings.Contains(err.Error(), "database is down") {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+}
+
+const responsesSpec = `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+paths:
+  /pets/{id}:
+    get:
+      operationId: getPet
+      summary: Get a pet
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        "200":
+          description: The pet
+          content:
+            application/xml:
+              schema:
+                type: string
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+        4xx:
+          $ref: '#/components/responses/Problem'
+        default:
+          description: Unexpected error
+          content:
+            text/plain:
+              schema:
+                type: string
+    delete:
+      operationId: deletePet
+      responses:
+        "204":
+          description: Deleted
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [id, name]
+      properties:
+        id:
+          type: integer
+        name:
+          type: string
+        tags:
+          type: array
+          items:
+            type: string
+        owner:
+          type: object
+          properties:
+            address:
+              type: object
+              properties:
+                city:
+                  type: string
+  responses:
+    Problem:
+      description: Client error
+      content:
+        application/problem+json:
+          schema:
+            type: object
+            properties:
+              title:
+                type: string
+`
+
+func TestFunctionResponses(t *testing.T) {
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(responsesSpec))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	fn := functions["getPet"]
+
+	ok := fn.Response(200)
+	if ok == nil || ok.ContentType != "application/json" || ok.Schema.Properties["name"] == nil {
+		t.Fatalf("Unexpected 200 response %+v", ok)
+	}
+	if r := fn.Response(404); r == nil || r.Description != "Client error" || r.Schema.Properties["title"] == nil {
+		t.Errorf("Expected 404 to match the 4XX range, got %+v", r)
+	}
+	if r := fn.Response(503); r == nil || r.Description != "Unexpected error" || r.ContentType != "text/plain" {
+		t.Errorf("Expected 503 to match default, got %+v", r)
+	}
+	if fn.Description != "Get a pet" {
+		t.Errorf("Expected no returns hint by default, got %q", fn.Description)
+	}
+	if r := functions["deletePet"].Response(204); r == nil || r.Schema != nil {
+		t.Errorf("Unexpected 204 response %+v", r)
+	}
+
+	functions, err = ConvertOpenAPIToFunctions(spec, WithReturnsHint())
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	want := "Get a pet\nreturns: {id: integer, name: string, owner: {address: object}, tags: string[]}"
+	if got := functions["getPet"].Description; got != want {
+		t.Errorf("Unexpected description with hint:\n%s\nexpected:\n%s", got, want)
+	}
+	if got := functions["deletePet"].Description; got != "" {
+		t.Errorf("Expected no hint without a response schema, got %q", got)
+	}
+
+	// Output validation
+	if err := ValidateResponse(fn, &APIResponse{StatusCode: 200, Body: map[string]any{"id": float64(1), "name": "Rex"}}); err != nil {
+		t.Errorf("Expected valid response, got %v", err)
+	}
+	err = ValidateResponse(fn, &APIResponse{StatusCode: 200, Body: map[string]any{"id": "1"}})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.StatusCode != 200 || len(verr.Violations) != 2 {
+		t.Errorf("Expected 2 violations, got %v", err)
+	}
+}
@@ -0,0 +1,460 @@
+package apiai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+// Besides OpenAPI 3.0 schemas it accepts 3.1 type arrays, numeric exclusive bounds
+// and boolean schemas; they are normalized by the spec once its version is known.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		*s = Schema{}
+		return nil
+	case "false":
+		*s = Schema{Not: &Schema{}}
+		return nil
+	}
+
+	type schemaAlias Schema
+	aux := struct {
+		*schemaAlias
+		Type             any `json:"type,omitempty"`
+		ExclusiveMinimum any `json:"exclusiveMinimum,omitempty"`
+		ExclusiveMaximum any `json:"exclusiveMaximum,omitempty"`
+	}{schemaAlias: (*schemaAlias)(s)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	return s.setVersionedKeywords(aux.Type, aux.ExclusiveMinimum, aux.ExclusiveMaximum)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *Schema) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.AliasNode {
+		return s.UnmarshalYAML(node.Alias)
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!bool" {
+		var allowed bool
+		if err := node.Decode(&allowed); err != nil {
+			return err
+		}
+		if allowed {
+			*s = Schema{}
+		} else {
+			*s = Schema{Not: &Schema{}}
+		}
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: schema must be an object", node.Line)
+	}
+
+	// Keywords with version specific forms are decoded separately
+	var typ, exclusiveMinimum, exclusiveMaximum any
+	rest := *node
+	rest.Content = nil
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		var target *any
+		switch key.Value {
+		case "type":
+			target = &typ
+		case "exclusiveMinimum":
+			target = &exclusiveMinimum
+		case "exclusiveMaximum":
+			target = &exclusiveMaximum
+		}
+		if target == nil {
+			rest.Content = append(rest.Content, key, value)
+			continue
+		}
+		if err := value.Decode(target); err != nil {
+			return err
+		}
+	}
+
+	type schemaAlias Schema
+	if err := rest.Decode((*schemaAlias)(s)); err != nil {
+		return err
+	}
+	return s.setVersionedKeywords(typ, exclusiveMinimum, exclusiveMaximum)
+}
+
+func (s *Schema) setVersionedKeywords(typ, exclusiveMinimum, exclusiveMaximum any) error {
+	switch t := typ.(type) {
+	case nil:
+	case string:
+		s.Type = t
+	case []any:
+		s.typeList = make([]string, 0, len(t))
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("invalid schema type %v", item)
+			}
+			s.typeList = append(s.typeList, name)
+		}
+	default:
+		return fmt.Errorf("invalid schema type %v", typ)
+	}
+
+	var err error
+	if s.ExclusiveMinimum, s.exclusiveMinimumValue, err = parseExclusiveBound("exclusiveMinimum", exclusiveMinimum); err != nil {
+		return err
+	}
+	if s.ExclusiveMaximum, s.exclusiveMaximumValue, err = parseExclusiveBound("exclusiveMaximum", exclusiveMaximum); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseExclusiveBound accepts the 3.0 boolean and the 3.1 numeric form
+func parseExclusiveBound(keyword string, value any) (bool, *float64, error) {
+	switch v := value.(type) {
+	case nil:
+		return false, nil, nil
+	case bool:
+		return v, nil, nil
+	case float64:
+		return false, &v, nil
+	case int:
+		f := float64(v)
+		return false, &f, nil
+	default:
+		return false, nil, fmt.Errorf("invalid %s %v", keyword, value)
+	}
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+// Normalized schemas are written as modeled, in the 3.0 form both versions read;
+// 3.1 type arrays and numeric exclusive bounds are written while they are kept
+// as parsed, and in tool schemas, see FunctionDefinition.ToolParameters.
+func (s Schema) MarshalJSON() ([]byte, error) {
+	type schemaAlias Schema
+	if s.typeList == nil && s.exclusiveMinimumValue == nil && s.exclusiveMaximumValue == nil {
+		return json.Marshal(schemaAlias(s))
+	}
+
+	out := struct {
+		schemaAlias
+		Type             any `json:"type,omitempty"`
+		ExclusiveMinimum any `json:"exclusiveMinimum,omitempty"`
+		ExclusiveMaximum any `json:"exclusiveMaximum,omitempty"`
+	}{schemaAlias: schemaAlias(s)}
+	switch {
+	case s.typeList != nil:
+		out.Type = s.typeList
+	case s.Type != "":
+		out.Type = s.Type
+	}
+	switch {
+	case s.exclusiveMinimumValue != nil:
+		out.ExclusiveMinimum = *s.exclusiveMinimumValue
+	case s.ExclusiveMinimum:
+		out.ExclusiveMinimum = true
+	}
+	switch {
+	case s.exclusiveMaximumValue != nil:
+		out.ExclusiveMaximum = *s.exclusiveMaximumValue
+	case s.ExclusiveMaximum:
+		out.ExclusiveMaximum = true
+	}
+	return json.Marshal(out)
+}
+
+// jsonSchema returns a copy of the normalized schema in the JSON Schema form of
+// tool schemas: nullable typed schemas with type arrays, e.g. ["string", "null"],
+// other nullable schemas with a {"type": "null"} union branch and numeric
+// exclusiveMinimum/exclusiveMaximum
+func (s *Schema) jsonSchema(seen map[*Schema]*Schema) *Schema {
+	if s == nil {
+		return nil
+	}
+	if c, ok := seen[s]; ok {
+		return c
+	}
+	c := *s
+	seen[s] = &c
+
+	if c.Properties != nil {
+		c.Properties = make(map[string]*Schema, len(s.Properties))
+		for name, prop := range s.Properties {
+			c.Properties[name] = prop.jsonSchema(seen)
+		}
+	}
+	if c.Defs != nil {
+		c.Defs = make(map[string]*Schema, len(s.Defs))
+		for name, def := range s.Defs {
+			c.Defs[name] = def.jsonSchema(seen)
+		}
+	}
+	c.Items = s.Items.jsonSchema(seen)
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+		c.AdditionalProperties = &AdditionalProperties{Schema: s.AdditionalProperties.Schema.jsonSchema(seen)}
+	}
+	for _, list := range []*[]*Schema{&c.AllOf, &c.OneOf, &c.AnyOf} {
+		if *list != nil {
+			schemas := make([]*Schema, len(*list))
+			for i, schema := range *list {
+				schemas[i] = schema.jsonSchema(seen)
+			}
+			*list = schemas
+		}
+	}
+	c.Not = s.Not.jsonSchema(seen)
+
+	if c.ExclusiveMinimum {
+		c.exclusiveMinimumValue, c.Minimum, c.ExclusiveMinimum = c.Minimum, nil, false
+	}
+	if c.ExclusiveMaximum {
+		c.exclusiveMaximumValue, c.Maximum, c.ExclusiveMaximum = c.Maximum, nil, false
+	}
+
+	if c.Nullable {
+		c.Nullable = false
+		null := &Schema{Type: "null"}
+		switch {
+		case c.Type == "null":
+		case c.Type != "":
+			c.typeList = []string{c.Type, "null"}
+		case len(c.AnyOf) > 0:
+			c.AnyOf = append(c.AnyOf, null)
+		case len(c.OneOf) > 0:
+			c.OneOf = append(c.OneOf, null)
+		case len(c.AllOf) > 0:
+			// e.g. allOf: [$ref] with nullable, the 3.0 form of a nullable reference
+			c.AnyOf = []*Schema{{AllOf: c.AllOf}, null}
+			c.AllOf = nil
+		}
+	}
+	return &c
+}
+
+// ToolParameters returns the parameters schema in the JSON Schema form of tool
+// definitions, e.g. for openai.FunctionParameters
+func (fn *FunctionDefinition) ToolParameters() (map[string]any, error) {
+	data, err := json.Marshal(fn.Parameters.jsonSchema(map[*Schema]*Schema{}))
+	if err != nil {
+		return nil, err
+	}
+	var params map[string]any
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+// The parameters are written in the JSON Schema form of ToolParameters.
+func (fn FunctionDefinition) MarshalJSON() ([]byte, error) {
+	type definitionAlias FunctionDefinition
+	return json.Marshal(struct {
+		definitionAlias
+		Parameters *Schema `json:"parameters"`
+	}{
+		definitionAlias: definitionAlias(fn),
+		Parameters:      fn.Parameters.jsonSchema(map[*Schema]*Schema{}),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+// Swagger 2.0 documents are upgraded to the OpenAPI 3 model,
+// schemas are normalized according to the spec version after decoding.
+func (s *OpenAPISpec) UnmarshalJSON(data []byte) error {
+	var probe struct {
+		Swagger string `json:"swagger"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+	if probe.Swagger != "" {
+		var sw swagger2Spec
+		if err := json.Unmarshal(data, &sw); err != nil {
+			return err
+		}
+		return s.setSwagger2(&sw)
+	}
+
+	type specAlias OpenAPISpec
+	var raw specAlias
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = OpenAPISpec(raw)
+	return s.normalize()
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+// Swagger 2.0 documents are upgraded to the OpenAPI 3 model,
+// schemas are normalized according to the spec version after decoding.
+func (s *OpenAPISpec) UnmarshalYAML(node *yaml.Node) error {
+	var probe struct {
+		Swagger string `yaml:"swagger"`
+	}
+	if err := node.Decode(&probe); err != nil {
+		return err
+	}
+	if probe.Swagger != "" {
+		var sw swagger2Spec
+		if err := node.Decode(&sw); err != nil {
+			return err
+		}
+		return s.setSwagger2(&sw)
+	}
+
+	type specAlias OpenAPISpec
+	var raw specAlias
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	*s = OpenAPISpec(raw)
+	return s.normalize()
+}
+
+func (s *OpenAPISpec) setSwagger2(sw *swagger2Spec) error {
+	if !strings.HasPrefix(sw.Swagger, "2.") {
+		return fmt.Errorf("unsupported swagger version %q", sw.Swagger)
+	}
+	spec, err := sw.toOpenAPI()
+	if err != nil {
+		return err
+	}
+	*s = *spec
+	return s.normalize()
+}
+
+// normalize brings the version specific schema forms to one internal form:
+// 3.1 type arrays and null unions are expressed with Nullable (as 3.0 nullable),
+// numeric exclusive bounds with Minimum/Maximum and the boolean flags.
+// 3.0 specs using 3.1 forms are rejected.
+func (s *OpenAPISpec) normalize() error {
+	allow31 := !strings.HasPrefix(s.OpenAPI, "3.0")
+	return walkSchemas(reflect.ValueOf(s), map[*Schema]bool{}, func(schema *Schema) error {
+		return schema.normalize(allow31)
+	})
+}
+
+func (s *Schema) normalize(allow31 bool) error {
+	if len(s.typeList) > 0 {
+		if !allow31 {
+			return fmt.Errorf("type %v: type arrays require OpenAPI 3.1", s.typeList)
+		}
+		var types []string
+		for _, t := range s.typeList {
+			if t == "null" {
+				s.Nullable = true
+			} else {
+				types = append(types, t)
+			}
+		}
+		switch len(types) {
+		case 0:
+			s.Type = "null"
+			s.Nullable = false
+		case 1:
+			s.Type = types[0]
+		default:
+			for _, t := range types {
+				s.AnyOf = append(s.AnyOf, &Schema{Type: t})
+			}
+		}
+		s.typeList = nil
+	}
+
+	if s.exclusiveMinimumValue != nil || s.exclusiveMaximumValue != nil {
+		if !allow31 {
+			return fmt.Errorf("numeric exclusiveMinimum and exclusiveMaximum require OpenAPI 3.1")
+		}
+		if s.exclusiveMinimumValue != nil {
+			s.Minimum, s.ExclusiveMinimum = s.exclusiveMinimumValue, true
+		}
+		if s.exclusiveMaximumValue != nil {
+			s.Maximum, s.ExclusiveMaximum = s.exclusiveMaximumValue, true
+		}
+		s.exclusiveMinimumValue, s.exclusiveMaximumValue = nil, nil
+	}
+
+	var nullable bool
+	s.AnyOf, nullable = removeNullSchemas(s.AnyOf)
+	s.Nullable = s.Nullable || nullable
+	s.OneOf, nullable = removeNullSchemas(s.OneOf)
+	s.Nullable = s.Nullable || nullable
+
+	return nil
+}
+
+// removeNullSchemas drops {"type": "null"} branches of a union, reporting if there were any
+func removeNullSchemas(schemas []*Schema) ([]*Schema, bool) {
+	var found bool
+	out := schemas[:0]
+	for _, schema := range schemas {
+		isNull := schema != nil && (schema.Type == "null" ||
+			len(schema.typeList) == 1 && schema.typeList[0] == "null")
+		if isNull {
+			found = true
+			continue
+		}
+		out = append(out, schema)
+	}
+	if len(out) == 0 {
+		return nil, found
+	}
+	return out, found
+}
+
+// walkSchemas calls fn for every schema reachable from v, parents before children
+func walkSchemas(v reflect.Value, seen map[*Schema]bool, fn func(*Schema) error) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		if schema, ok := v.Interface().(*Schema); ok {
+			if seen[schema] {
+				return nil
+			}
+			seen[schema] = true
+			if err := fn(schema); err != nil {
+				return err
+			}
+		}
+		return walkSchemas(v.Elem(), seen, fn)
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if err := walkSchemas(v.Field(i), seen, fn); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := walkSchemas(iter.Value(), seen, fn); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkSchemas(v.Index(i), seen, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package apiai
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const openAPI31Spec = `
+openapi: 3.1.0
+info:
+  title: Pets
+  version: 1.0.0
+paths:
+  /pets:
+    post:
+      summary: Add a pet
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+webhooks:
+  newPet:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: [object, 'null']
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        name:
+          type: [string, 'null']
+          examples: [Tom, Rex]
+        kind:
+          const: cat
+        age:
+          type: integer
+          exclusiveMinimum: 0
+        id:
+          type: [string, integer]
+        owner:
+          anyOf:
+            - $ref: '#/components/schemas/Pet/$defs/Owner'
+            - type: 'null'
+      $defs:
+        Owner:
+          type: object
+          properties:
+            email:
+              type: string
+`
+
+func TestOpenAPI31Normalization(t *testing.T) {
+	yamlSpec, err := UnmarshalOpenAPISpecFromYAML([]byte(openAPI31Spec))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+
+	// The same document as JSON must produce the same model
+	data, err := json.Marshal(yamlSpec)
+	if err != nil {
+		t.Fatalf("Failed to marshal spec: %v", err)
+	}
+	jsonSpec, err := UnmarshalOpenAPISpecFromJSON(data)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal JSON: %v", err)
+	}
+
+	for name, spec := range map[string]*OpenAPISpec{"yaml": yamlSpec, "json": jsonSpec} {
+		pet := spec.Components.Schemas["Pet"]
+
+		if n := pet.Properties["name"]; n.Type != "string" || !n.Nullable || len(n.Examples) != 2 {
+			t.Errorf("%s: expected nullable string name with examples, got %+v", name, n)
+		}
+		if k := pet.Properties["kind"]; k.Const != "cat" {
+			t.Errorf("%s: expected const 'cat', got %+v", name, k.Const)
+		}
+		if a := pet.Properties["age"]; a.Minimum == nil || *a.Minimum != 0 || !a.ExclusiveMinimum {
+			t.Errorf("%s: expected exclusive minimum 0, got %+v", name, a)
+		}
+		if id := pet.Properties["id"]; id.Type != "" || len(id.AnyOf) != 2 || id.AnyOf[1].Type != "integer" {
+			t.Errorf("%s: expected id to be a string/integer union, got %+v", name, id)
+		}
+		if o := pet.Properties["owner"]; !o.Nullable || len(o.AnyOf) != 1 {
+			t.Errorf("%s: expected nullable owner without null branch, got %+v", name, o)
+		}
+		hook := spec.Webhooks["newPet"].Post.RequestBody.Content["application/json"].Schema
+		if hook.Type != "object" || !hook.Nullable {
+			t.Errorf("%s: expected nullable object webhook body, got %+v", name, hook)
+		}
+
+		functions, err := ConvertOpenAPIToFunctions(spec)
+		if err != nil {
+			t.Fatalf("%s: failed to convert spec: %v", name, err)
+		}
+		if len(functions) != 1 {
+			t.Errorf("%s: expected webhooks to be skipped, got %d functions", name, len(functions))
+		}
+		owner := functions["post_pets"].Parameters.Properties["requestBody"].Properties["owner"]
+		if owner.AnyOf[0].Properties["email"] == nil {
+			t.Errorf("%s: expected $defs reference to be resolved, got %+v", name, owner.AnyOf[0])
+		}
+	}
+}
+
+func TestOpenAPI30Nullable(t *testing.T) {
+	spec, err := UnmarshalOpenAPISpec([]byte(`{
+		"openapi": "3.0.3",
+		"info": {"title": "Pets", "version": "1.0.0"},
+		"paths": {
+			"/pets": {
+				"get": {
+					"operationId": "listPets",
+					"parameters": [
+						{"name": "limit", "in": "query", "schema": {"$ref": "#/components/schemas/Limit"}}
+					],
+					"responses": {"200": {"description": "OK"}}
+				}
+			}
+		},
+		"components": {
+			"schemas": {
+				"Limit": {"type": "integer", "nullable": true, "minimum": 1, "exclusiveMinimum": true}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal spec: %v", err)
+	}
+
+	// The spec model is written in its 3.0 form and read back
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatalf("Failed to marshal spec: %v", err)
+	}
+	if _, err := UnmarshalOpenAPISpec(data); err != nil {
+		t.Fatalf("Failed to unmarshal marshaled spec: %v", err)
+	}
+	data, err = json.Marshal(spec.Components.Schemas["Limit"])
+	if err != nil {
+		t.Fatalf("Failed to marshal schema: %v", err)
+	}
+	want := `{"type":"integer","nullable":true,"minimum":1,"exclusiveMinimum":true}`
+	if string(data) != want {
+		t.Errorf("Unexpected schema JSON:\n got  %s\n want %s", data, want)
+	}
+
+	// Tool schemas use the JSON Schema form
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	params, err := functions["listPets"].ToolParameters()
+	if err != nil {
+		t.Fatalf("Failed to get tool parameters: %v", err)
+	}
+	data, _ = json.Marshal(params["properties"].(map[string]any)["limit"])
+	want = `{"exclusiveMinimum":1,"type":["integer","null"]}`
+	if string(data) != want {
+		t.Errorf("Unexpected tool schema JSON:\n got  %s\n want %s", data, want)
+	}
+}
+
+func TestOpenAPI30RejectsTypeArrays(t *testing.T) {
+	specYAML := `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+paths: {}
+components:
+  schemas:
+    Name:
+      type: [string, 'null']
+`
+	if _, err := UnmarshalOpenAPISpecFromYAML([]byte(specYAML)); err == nil {
+		t.Errorf("Expected error for a type array in OpenAPI 3.0")
+	}
+}
+
+func TestOpenAPI31ToolSchema(t *testing.T) {
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(openAPI31Spec))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	params, err := functions["post_pets"].ToolParameters()
+	if err != nil {
+		t.Fatalf("Failed to get tool parameters: %v", err)
+	}
+	body := params["properties"].(map[string]any)["requestBody"].(map[string]any)["properties"].(map[string]any)
+	nullableAllOf, err := (&FunctionDefinition{Parameters: Schema{Nullable: true, AllOf: []*Schema{{Type: "object"}}}}).ToolParameters()
+	if err != nil {
+		t.Fatalf("Failed to get tool parameters: %v", err)
+	}
+
+	// Tool schemas keep the 3.1 forms, not the normalized 3.0 ones
+	tests := []struct {
+		name   string
+		schema any
+		want   string
+	}{
+		{"age", body["age"], `{"exclusiveMinimum":0,"type":"integer"}`},
+		{"owner", body["owner"], `{"anyOf":[{"properties":{"email":{"type":"string"}},"type":"object"},{"type":"null"}]}`},
+		{"nullable allOf", nullableAllOf, `{"anyOf":[{"allOf":[{"type":"object"}]},{"type":"null"}]}`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.schema)
+		if err != nil {
+			t.Fatalf("%s: failed to marshal schema: %v", tt.name, err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s: unexpected schema JSON:\n got  %s\n want %s", tt.name, data, tt.want)
+		}
+	}
+}
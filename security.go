@@ -0,0 +1,241 @@
+package apiai
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// SecurityRequirement maps security scheme names to the required scopes.
+// All schemes of a requirement apply together, a list of requirements
+// is satisfied by any one of them.
+type SecurityRequirement map[string][]string
+
+// CredentialRegistry holds credentials by security scheme name.
+// Credentials are AuthConfig values, their Type and APIKeyName are
+// derived from the scheme declared in the spec when not set.
+type CredentialRegistry struct {
+	mu          sync.RWMutex
+	schemes     map[string]*SecurityScheme
+	credentials map[string]*AuthConfig
+
+	// tokenSources caches the tokens of oauth2 flows by scheme and scope set
+	tokenSources map[string]oauth2.TokenSource
+}
+
+// NewCredentialRegistry creates a registry for the security schemes of the spec
+func NewCredentialRegistry(spec *OpenAPISpec) (*CredentialRegistry, error) {
+	r := &CredentialRegistry{
+		schemes:      map[string]*SecurityScheme{},
+		credentials:  map[string]*AuthConfig{},
+		tokenSources: map[string]oauth2.TokenSource{},
+	}
+	if spec == nil || spec.Components == nil {
+		return r, nil
+	}
+	for name, scheme := range spec.Components.SecuritySchemes {
+		resolved, err := resolveSecuritySchemeRef(scheme, spec)
+		if err != nil {
+			return nil, fmt.Errorf("security scheme %q: %w", name, err)
+		}
+		if resolved != nil {
+			r.schemes[name] = resolved
+		}
+	}
+	return r, nil
+}
+
+// Scheme returns the security scheme declared with the name
+func (r *CredentialRegistry) Scheme(name string) (*SecurityScheme, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	scheme, ok := r.schemes[name]
+	return scheme, ok
+}
+
+// Set registers the credentials of a scheme, Type and APIKeyName
+// are taken from the scheme declaration when empty. OAuth2 credentials
+// with a client ID or refresh token and no token obtain tokens from the
+// flows of the scheme, see SetClientCredentials.
+func (r *CredentialRegistry) Set(name string, config *AuthConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cred := *config
+	if scheme, ok := r.schemes[name]; ok {
+		if err := applySchemeDefaults(scheme, &cred); err != nil {
+			return fmt.Errorf("security scheme %q: %w", name, err)
+		}
+		if usesOAuth2Flow(&cred) {
+			if _, err := oauth2Flow(scheme, &cred); err != nil {
+				return fmt.Errorf("security scheme %q: %w", name, err)
+			}
+		}
+	} else if cred.Type == "" {
+		return fmt.Errorf("unknown security scheme %q", name)
+	}
+	r.credentials[name] = &cred
+	r.dropTokenSources(name)
+	return nil
+}
+
+// dropTokenSources drops the cached tokens of the replaced credentials of the scheme
+func (r *CredentialRegistry) dropTokenSources(name string) {
+	for key := range r.tokenSources {
+		if strings.HasPrefix(key, name+"\x00") {
+			delete(r.tokenSources, key)
+		}
+	}
+}
+
+// SetAPIKey registers the key of an apiKey scheme
+func (r *CredentialRegistry) SetAPIKey(name, value string) error {
+	return r.Set(name, &AuthConfig{APIKeyValue: value})
+}
+
+// SetBasic registers the user and password of an http basic scheme
+func (r *CredentialRegistry) SetBasic(name, username, password string) error {
+	return r.Set(name, &AuthConfig{Username: username, Password: password})
+}
+
+// SetToken registers the token of an http bearer, oauth2 or openIdConnect scheme
+func (r *CredentialRegistry) SetToken(name, token string) error {
+	return r.Set(name, &AuthConfig{Token: token})
+}
+
+// credential returns the credentials registered for the scheme, with
+// a token source for the scopes when they use an oauth2 flow
+func (r *CredentialRegistry) credential(name string, scopes []string) (*AuthConfig, bool, error) {
+	r.mu.RLock()
+	cred, ok := r.credentials[name]
+	r.mu.RUnlock()
+	if !ok || !usesOAuth2Flow(cred) {
+		return cred, ok, nil
+	}
+
+	ts, err := r.scopedTokenSource(name, cred, scopes)
+	if err != nil {
+		return nil, false, err
+	}
+	scoped := *cred
+	scoped.TokenSource = ts
+	scoped.registered, scoped.scopes = cred, scopes
+	return &scoped, true, nil
+}
+
+// withSchemeDefaults returns a copy of config completed from the scheme
+// declared with the name, config is returned as is for unknown schemes
+func (r *CredentialRegistry) withSchemeDefaults(name string, config *AuthConfig) (*AuthConfig, error) {
+	scheme, ok := r.Scheme(name)
+	if !ok {
+		return config, nil
+	}
+	cred := *config
+	if err := applySchemeDefaults(scheme, &cred); err != nil {
+		return nil, fmt.Errorf("security scheme %q: %w", name, err)
+	}
+	return &cred, nil
+}
+
+// applySchemeDefaults sets the Type and APIKeyName of cred from the scheme when empty
+func applySchemeDefaults(scheme *SecurityScheme, cred *AuthConfig) error {
+	authType, keyName, err := schemeAuthType(scheme)
+	if err != nil {
+		return err
+	}
+	if cred.Type == "" {
+		cred.Type = authType
+	}
+	if cred.APIKeyName == "" {
+		cred.APIKeyName = keyName
+	}
+	return nil
+}
+
+// schemeAuthType maps a security scheme to the auth type applying it
+func schemeAuthType(scheme *SecurityScheme) (AuthType, string, error) {
+	switch scheme.Type {
+	case "apiKey":
+		switch scheme.In {
+		case "header":
+			return AuthTypeAPIKeyHeader, scheme.Name, nil
+		case "cookie":
+			return AuthTypeAPIKeyCookie, scheme.Name, nil
+		case "query":
+			return AuthTypeAPIKeyQuery, scheme.Name, nil
+		}
+		return "", "", fmt.Errorf("apiKey in %q is not supported", scheme.In)
+	case "http":
+		switch strings.ToLower(scheme.Scheme) {
+		case "basic":
+			return AuthTypeBasic, "", nil
+		case "bearer":
+			return AuthTypeBearer, "", nil
+		case "digest":
+			return AuthTypeDigest, "", nil
+		}
+		return "", "", fmt.Errorf("http scheme %q is not supported", scheme.Scheme)
+	case "oauth2", "openIdConnect":
+		return AuthTypeOAuth2, "", nil
+	}
+	return "", "", fmt.Errorf("security scheme type %q is not supported", scheme.Type)
+}
+
+// credentialLookup returns the credentials of a scheme for the required scopes
+type credentialLookup func(name string, scopes []string) (*AuthConfig, bool, error)
+
+// resolveSecurity picks the first requirement all schemes of which have credentials.
+// An empty requirement makes authentication optional. Credentials shared by
+// several schemes of a requirement, e.g. the client config, are applied once.
+func resolveSecurity(requirements []SecurityRequirement, lookup credentialLookup) ([]*AuthConfig, error) {
+	if len(requirements) == 0 {
+		return nil, nil
+	}
+	for _, req := range requirements {
+		configs := make([]*AuthConfig, 0, len(req))
+		for _, name := range slices.Sorted(maps.Keys(req)) {
+			cred, ok, err := lookup(name, req[name])
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				configs = nil
+				break
+			}
+			if !slices.Contains(configs, cred) {
+				configs = append(configs, cred)
+			}
+		}
+		if configs != nil {
+			return configs, nil
+		}
+	}
+
+	names := make([]string, 0, len(requirements))
+	for _, req := range requirements {
+		names = append(names, strings.Join(slices.Sorted(maps.Keys(req)), "+"))
+	}
+	return nil, fmt.Errorf("no credentials for security requirements %s", strings.Join(names, " or "))
+}
+
+type securityContextKey struct{}
+
+// ContextWithSecurity returns a context carrying the security requirements
+// of the operation, AuthRoundTripper applies them from the registry
+func ContextWithSecurity(ctx context.Context, requirements []SecurityRequirement) context.Context {
+	if requirements == nil {
+		requirements = []SecurityRequirement{}
+	}
+	return context.WithValue(ctx, securityContextKey{}, requirements)
+}
+
+// securityFromContext returns the security requirements of the request
+func securityFromContext(ctx context.Context) ([]SecurityRequirement, bool) {
+	requirements, ok := ctx.Value(securityContextKey{}).([]SecurityRequirement)
+	return requirements, ok
+}
@@ -0,0 +1,277 @@
+package apiai
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const securitySpec = `
+openapi: 3.0.0
+info:
+  title: Secured
+  version: 1.0.0
+security:
+  - apiKey: []
+paths:
+  /default:
+    get:
+      operationId: defaultSecurity
+  /public:
+    get:
+      operationId: public
+      security: []
+  /both:
+    get:
+      operationId: both
+      security:
+        - apiKey: []
+          basic: []
+  /either:
+    get:
+      operationId: either
+      security:
+        - bearer: []
+        - basic: []
+  /session:
+    get:
+      operationId: session
+      security:
+        - session: []
+components:
+  securitySchemes:
+    apiKey:
+      type: apiKey
+      in: header
+      name: X-API-Key
+    basic:
+      type: http
+      scheme: basic
+    bearer:
+      type: http
+      scheme: bearer
+    session:
+      type: apiKey
+      in: cookie
+      name: sid
+`
+
+func TestExecuteFunctionSecurity(t *testing.T) {
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(securitySpec))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	if s := functions["public"].Security; s == nil || len(s) != 0 {
+		t.Errorf("Expected empty security for public, got %v", s)
+	}
+	if s := functions["defaultSecurity"].Security; len(s) != 1 || s[0]["apiKey"] == nil {
+		t.Errorf("Expected spec level security, got %v", s)
+	}
+
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	registry, err := NewCredentialRegistry(spec)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if err := registry.SetAPIKey("apiKey", "secret"); err != nil {
+		t.Fatalf("Failed to set api key: %v", err)
+	}
+	if err := registry.SetBasic("basic", "user", "pass"); err != nil {
+		t.Fatalf("Failed to set basic: %v", err)
+	}
+	if err := registry.SetAPIKey("session", "s1"); err != nil {
+		t.Fatalf("Failed to set session: %v", err)
+	}
+	if err := registry.SetToken("unknown", "t"); err == nil {
+		t.Errorf("Expected an error for an unknown scheme")
+	}
+
+	// The global config must not leak into operations with declared security
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeBearer, Token: "global"}, WithCredentialRegistry(registry))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	tests := []struct {
+		function string
+		apiKey   string
+		user     string
+		bearer   bool
+		cookie   string
+	}{
+		{"defaultSecurity", "secret", "", false, ""},
+		{"public", "", "", false, ""},
+		{"both", "secret", "user", false, ""},
+		{"either", "", "user", false, ""},
+		{"session", "", "", false, "s1"},
+	}
+	for _, tt := range tests {
+		if _, err := ExecuteFunction(client, functions[tt.function], nil); err != nil {
+			t.Fatalf("%s: failed to execute function: %v", tt.function, err)
+		}
+		if v := got.Header.Get("X-API-Key"); v != tt.apiKey {
+			t.Errorf("%s: expected api key %q, got %q", tt.function, tt.apiKey, v)
+		}
+		if user, _, _ := got.BasicAuth(); user != tt.user {
+			t.Errorf("%s: expected basic user %q, got %q", tt.function, tt.user, user)
+		}
+		if tt.user == "" && !tt.bearer && got.Header.Get("Authorization") != "" {
+			t.Errorf("%s: unexpected Authorization %q", tt.function, got.Header.Get("Authorization"))
+		}
+		if c, err := got.Cookie("sid"); (err == nil) != (tt.cookie != "") || (err == nil && c.Value != tt.cookie) {
+			t.Errorf("%s: expected cookie %q, got %v", tt.function, tt.cookie, c)
+		}
+	}
+
+	// The first satisfiable requirement wins
+	if err := registry.SetToken("bearer", "tok"); err != nil {
+		t.Fatalf("Failed to set bearer: %v", err)
+	}
+	if _, err := ExecuteFunction(client, functions["either"], nil); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	if got.Header.Get("Authorization") != "Bearer tok" {
+		t.Errorf("Expected bearer token, got %q", got.Header.Get("Authorization"))
+	}
+
+	// Missing credentials fail before sending the request
+	registry, _ = NewCredentialRegistry(spec)
+	client, _ = NewAPIClient(srv.URL, nil, WithCredentialRegistry(registry))
+	got = nil
+	_, err = ExecuteFunction(client, functions["both"], nil)
+	if err == nil || !strings.Contains(err.Error(), "no credentials for security requirements apiKey+basic") {
+		t.Errorf("Expected missing credentials error, got %v", err)
+	}
+	if got != nil {
+		t.Errorf("Expected no request without credentials")
+	}
+
+	// Functions without declared security use the client config
+	client, _ = NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeBearer, Token: "global"}, WithCredentialRegistry(registry))
+	if _, err := ExecuteFunction(client, &FunctionDefinition{Name: "plain", OapiMethod: http.MethodGet, OapiPath: "/plain"}, nil); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	if got.Header.Get("Authorization") != "Bearer global" {
+		t.Errorf("Expected global bearer token, got %q", got.Header.Get("Authorization"))
+	}
+}
+
+func TestSwagger2Security(t *testing.T) {
+	specYAML := `
+swagger: "2.0"
+info:
+  title: Secured
+  version: 1.0.0
+security:
+  - key: []
+securityDefinitions:
+  key:
+    type: apiKey
+    in: header
+    name: X-Key
+paths:
+  /open:
+    get:
+      operationId: open
+      security: []
+  /closed:
+    get:
+      operationId: closed
+`
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(specYAML))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	if s := functions["open"].Security; s == nil || len(s) != 0 {
+		t.Errorf("Expected empty security for open, got %v", s)
+	}
+	if s := functions["closed"].Security; len(s) != 1 || s[0]["key"] == nil {
+		t.Errorf("Expected spec level security for closed, got %v", s)
+	}
+
+	registry, err := NewCredentialRegistry(spec)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if scheme, ok := registry.Scheme("key"); !ok || scheme.In != "header" || scheme.Name != "X-Key" {
+		t.Errorf("Unexpected scheme %+v", scheme)
+	}
+}
+
+// failingTransport fails every request with an error quoting the URL
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("dial %s: connection refused", req.URL)
+}
+
+func TestAPIKeyQuery(t *testing.T) {
+	var gotQuery []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = append(gotQuery, r.URL.RawQuery)
+		if r.URL.Path == "/old" {
+			// Redirects commonly echo the query string
+			http.Redirect(w, r, "/new?"+r.URL.RawQuery, http.StatusFound)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeAPIKeyQuery, APIKeyName: "api_key", APIKeyValue: "s3cr+t"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	fn := &FunctionDefinition{Name: "old", OapiMethod: http.MethodGet, OapiPath: "/old", QueryParams: []string{"ids"}}
+	fn.OapiParams = map[string]*Parameter{"ids": {Name: "ids", In: "query", Explode: boolPtr(false)}}
+	if _, err := ExecuteFunction(client, fn, map[string]any{"ids": []any{1, 2}}); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	want := []string{"ids=1,2&api_key=s3cr%2Bt", "ids=1,2&api_key=s3cr%2Bt"}
+	if strings.Join(gotQuery, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected queries %q, got %q", want, gotQuery)
+	}
+
+	// The key is redacted from transport errors
+	client.HTTPClient.Transport.(*AuthRoundTripper).transport = failingTransport{}
+	_, err = ExecuteFunction(client, fn, nil)
+	if err == nil || strings.Contains(err.Error(), "s3cr") || !strings.Contains(err.Error(), "api_key=REDACTED") {
+		t.Errorf("Expected redacted error, got %v", err)
+	}
+
+	// Query keys declared by the spec
+	registry, err := NewCredentialRegistry(&OpenAPISpec{Components: &Components{SecuritySchemes: map[string]*SecurityScheme{
+		"key": {Type: "apiKey", In: "query", Name: "appid"},
+	}}})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if err := registry.SetAPIKey("key", "k1"); err != nil {
+		t.Fatalf("Failed to set api key: %v", err)
+	}
+	gotQuery = nil
+	client, _ = NewAPIClient(srv.URL, nil, WithCredentialRegistry(registry))
+	fn = &FunctionDefinition{Name: "weather", OapiMethod: http.MethodGet, OapiPath: "/weather", Security: []SecurityRequirement{{"key": nil}}}
+	if _, err := ExecuteFunction(client, fn, nil); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	if len(gotQuery) != 1 || gotQuery[0] != "appid=k1" {
+		t.Errorf("Unexpected query %q", gotQuery)
+	}
+}
@@ -0,0 +1,348 @@
+package apiai
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Parameter serialization styles
+const (
+	StyleMatrix         = "matrix"
+	StyleLabel          = "label"
+	StyleSimple         = "simple"
+	StyleForm           = "form"
+	StyleSpaceDelimited = "spaceDelimited"
+	StylePipeDelimited  = "pipeDelimited"
+	StyleDeepObject     = "deepObject"
+)
+
+// parameter returns the resolved parameter, or a default one
+// for definitions built without OapiParams
+func (fn *FunctionDefinition) parameter(name, in string) *Parameter {
+	if p, ok := fn.OapiParams[name]; ok && p.In == in {
+		return p
+	}
+	return &Parameter{Name: name, In: in}
+}
+
+// style returns the parameter style, defaulting by location
+func (p *Parameter) style() string {
+	if p.Style != "" {
+		return p.Style
+	}
+	switch p.In {
+	case "query", "cookie":
+		return StyleForm
+	default:
+		return StyleSimple
+	}
+}
+
+// explode returns the explode flag, which defaults to true only for the form style
+func (p *Parameter) explode() bool {
+	if p.Explode != nil {
+		return *p.Explode
+	}
+	return p.style() == StyleForm
+}
+
+// paramValue is an argument value split by its shape
+type paramValue struct {
+	isArray  bool
+	isObject bool
+	scalar   string
+	items    []string
+	keys     []string // sorted, so serialization is deterministic
+	values   map[string]string
+}
+
+func newParamValue(value any) (paramValue, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			// []byte is a string
+			break
+		}
+		pv := paramValue{isArray: true}
+		for i := 0; i < v.Len(); i++ {
+			item, err := formatScalar(v.Index(i).Interface())
+			if err != nil {
+				return pv, err
+			}
+			pv.items = append(pv.items, item)
+		}
+		return pv, nil
+
+	case reflect.Map:
+		pv := paramValue{isObject: true, values: map[string]string{}}
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			item, err := formatScalar(iter.Value().Interface())
+			if err != nil {
+				return pv, err
+			}
+			pv.keys = append(pv.keys, key)
+			pv.values[key] = item
+		}
+		slices.Sort(pv.keys)
+		return pv, nil
+	}
+
+	scalar, err := formatScalar(value)
+	return paramValue{scalar: scalar}, err
+}
+
+// formatScalar formats a primitive value, JSON numbers without exponent
+func formatScalar(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	}
+
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		return "", fmt.Errorf("nested value %v can not be serialized with this style", value)
+	}
+	return fmt.Sprint(value), nil
+}
+
+// join serializes array items or object key/value pairs with the given separators,
+// escaping every element with escape
+func (pv paramValue) join(sep, kvSep string, escape func(string) string) string {
+	var parts []string
+	switch {
+	case pv.isArray:
+		for _, item := range pv.items {
+			parts = append(parts, escape(item))
+		}
+	case pv.isObject:
+		for _, key := range pv.keys {
+			if kvSep == sep {
+				parts = append(parts, escape(key), escape(pv.values[key]))
+			} else {
+				parts = append(parts, escape(key)+kvSep+escape(pv.values[key]))
+			}
+		}
+	default:
+		return escape(pv.scalar)
+	}
+	return strings.Join(parts, sep)
+}
+
+// serializePathParam serializes a path parameter with the simple, label or matrix style
+func serializePathParam(p *Parameter, value any) (string, error) {
+	pv, err := newParamValue(value)
+	if err != nil {
+		return "", fmt.Errorf("parameter %q: %w", p.Name, err)
+	}
+	explode := p.explode()
+	escape := escapePathValue
+
+	switch p.style() {
+	case StyleSimple:
+		if explode {
+			return pv.join(",", "=", escape), nil
+		}
+		return pv.join(",", ",", escape), nil
+
+	case StyleLabel:
+		if explode {
+			return "." + pv.join(".", "=", escape), nil
+		}
+		return "." + pv.join(",", ",", escape), nil
+
+	case StyleMatrix:
+		name := escape(p.Name)
+		switch {
+		case explode && pv.isArray:
+			var b strings.Builder
+			for _, item := range pv.items {
+				b.WriteString(";" + name + "=" + escape(item))
+			}
+			return b.String(), nil
+		case explode && pv.isObject:
+			return ";" + pv.join(";", "=", escape), nil
+		case !pv.isArray && !pv.isObject && pv.scalar == "":
+			return ";" + name, nil
+		default:
+			return ";" + name + "=" + pv.join(",", ",", escape), nil
+		}
+
+	default:
+		return "", fmt.Errorf("parameter %q: style %q is not supported in path", p.Name, p.style())
+	}
+}
+
+// serializeQueryParam serializes a query parameter into escaped "name=value" pairs
+func serializeQueryParam(p *Parameter, value any) ([]string, error) {
+	escape := func(s string) string {
+		return escapeQueryValue(s, p.AllowReserved)
+	}
+	name := escapeQueryValue(p.Name, false)
+	explode := p.explode()
+
+	if p.style() == StyleDeepObject {
+		if reflect.ValueOf(value).Kind() != reflect.Map {
+			return nil, fmt.Errorf("parameter %q: deepObject style requires an object", p.Name)
+		}
+		return deepObjectPairs(name, value, escape)
+	}
+
+	pv, err := newParamValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("parameter %q: %w", p.Name, err)
+	}
+
+	var sep string
+	switch p.style() {
+	case StyleForm:
+		sep = ","
+	case StyleSpaceDelimited:
+		sep = "%20"
+	case StylePipeDelimited:
+		sep = "|"
+	default:
+		return nil, fmt.Errorf("parameter %q: style %q is not supported in query", p.Name, p.style())
+	}
+
+	switch {
+	case explode && pv.isArray:
+		pairs := make([]string, 0, len(pv.items))
+		for _, item := range pv.items {
+			pairs = append(pairs, name+"="+escape(item))
+		}
+		return pairs, nil
+	case explode && pv.isObject:
+		pairs := make([]string, 0, len(pv.keys))
+		for _, key := range pv.keys {
+			pairs = append(pairs, escape(key)+"="+escape(pv.values[key]))
+		}
+		return pairs, nil
+	default:
+		return []string{name + "=" + pv.join(sep, sep, escape)}, nil
+	}
+}
+
+// deepObjectPairs renders nested objects as name[key][sub]=value pairs
+func deepObjectPairs(prefix string, value any, escape func(string) string) ([]string, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Map {
+		scalar, err := formatScalar(value)
+		if err != nil {
+			return nil, err
+		}
+		return []string{prefix + "=" + escape(scalar)}, nil
+	}
+
+	keys := make([]string, 0, v.Len())
+	values := map[string]any{}
+	iter := v.MapRange()
+	for iter.Next() {
+		key := fmt.Sprint(iter.Key().Interface())
+		keys = append(keys, key)
+		values[key] = iter.Value().Interface()
+	}
+	slices.Sort(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		sub, err := deepObjectPairs(prefix+"["+escape(key)+"]", values[key], escape)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, sub...)
+	}
+	return pairs, nil
+}
+
+// serializeHeaderParam serializes a header parameter with the simple style
+func serializeHeaderParam(p *Parameter, value any) (string, error) {
+	if p.style() != StyleSimple {
+		return "", fmt.Errorf("parameter %q: style %q is not supported in header", p.Name, p.style())
+	}
+	pv, err := newParamValue(value)
+	if err != nil {
+		return "", fmt.Errorf("parameter %q: %w", p.Name, err)
+	}
+	noEscape := func(s string) string { return s }
+	if p.explode() {
+		return pv.join(",", "=", noEscape), nil
+	}
+	return pv.join(",", ",", noEscape), nil
+}
+
+// serializeCookieParam serializes a cookie parameter with the form style,
+// exploded arrays and objects produce several cookies
+func serializeCookieParam(p *Parameter, value any) ([]*http.Cookie, error) {
+	if p.style() != StyleForm {
+		return nil, fmt.Errorf("parameter %q: style %q is not supported in cookie", p.Name, p.style())
+	}
+	pv, err := newParamValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("parameter %q: %w", p.Name, err)
+	}
+	noEscape := func(s string) string { return s }
+
+	switch {
+	case p.explode() && pv.isArray:
+		cookies := make([]*http.Cookie, 0, len(pv.items))
+		for _, item := range pv.items {
+			cookies = append(cookies, &http.Cookie{Name: p.Name, Value: item})
+		}
+		return cookies, nil
+	case p.explode() && pv.isObject:
+		cookies := make([]*http.Cookie, 0, len(pv.keys))
+		for _, key := range pv.keys {
+			cookies = append(cookies, &http.Cookie{Name: key, Value: pv.values[key]})
+		}
+		return cookies, nil
+	default:
+		return []*http.Cookie{{Name: p.Name, Value: pv.join(",", ",", noEscape)}}, nil
+	}
+}
+
+// escapePathValue percent-encodes everything but RFC 3986 unreserved characters
+func escapePathValue(s string) string {
+	return percentEncode(s, false)
+}
+
+// escapeQueryValue percent-encodes a query component, reserved characters
+// are kept as is when allowReserved is set
+func escapeQueryValue(s string, allowReserved bool) string {
+	return percentEncode(s, allowReserved)
+}
+
+func percentEncode(s string, allowReserved bool) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreserved(c) || allowReserved && strings.IndexByte(":/?#[]@!$&'()*+,;=", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,207 @@
+package apiai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Values of the style examples in the OpenAPI specification,
+// object keys are serialized in sorted order
+var (
+	styleString = "blue"
+	styleArray  = []any{"blue", "black", "brown"}
+	styleObject = map[string]any{"R": float64(100), "G": float64(200), "B": float64(150)}
+)
+
+func TestSerializePathParam(t *testing.T) {
+	tests := []struct {
+		style   string
+		explode bool
+		value   any
+		want    string
+	}{
+		{StyleSimple, false, styleString, "blue"},
+		{StyleSimple, false, styleArray, "blue,black,brown"},
+		{StyleSimple, false, styleObject, "B,150,G,200,R,100"},
+		{StyleSimple, true, styleArray, "blue,black,brown"},
+		{StyleSimple, true, styleObject, "B=150,G=200,R=100"},
+		{StyleLabel, false, "", "."},
+		{StyleLabel, false, styleString, ".blue"},
+		{StyleLabel, false, styleArray, ".blue,black,brown"},
+		{StyleLabel, false, styleObject, ".B,150,G,200,R,100"},
+		{StyleLabel, true, styleArray, ".blue.black.brown"},
+		{StyleLabel, true, styleObject, ".B=150.G=200.R=100"},
+		{StyleMatrix, false, "", ";color"},
+		{StyleMatrix, false, styleString, ";color=blue"},
+		{StyleMatrix, false, styleArray, ";color=blue,black,brown"},
+		{StyleMatrix, false, styleObject, ";color=B,150,G,200,R,100"},
+		{StyleMatrix, true, styleArray, ";color=blue;color=black;color=brown"},
+		{StyleMatrix, true, styleObject, ";B=150;G=200;R=100"},
+		{StyleSimple, false, "a/b c", "a%2Fb%20c"},
+		{StyleSimple, false, float64(1e6), "1000000"},
+	}
+	for _, tt := range tests {
+		explode := tt.explode
+		p := &Parameter{Name: "color", In: "path", Style: tt.style, Explode: &explode}
+		got, err := serializePathParam(p, tt.value)
+		if err != nil {
+			t.Errorf("%s explode=%v %v: %v", tt.style, tt.explode, tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s explode=%v %v: expected %q, got %q", tt.style, tt.explode, tt.value, tt.want, got)
+		}
+	}
+
+	if _, err := serializePathParam(&Parameter{Name: "color", In: "path", Style: StyleForm}, styleString); err == nil {
+		t.Errorf("Expected an error for the form style in path")
+	}
+}
+
+func TestSerializeQueryParam(t *testing.T) {
+	tests := []struct {
+		style         string
+		explode       *bool
+		allowReserved bool
+		value         any
+		want          string
+	}{
+		// Defaults to form with explode
+		{"", nil, false, styleString, "color=blue"},
+		{"", nil, false, styleArray, "color=blue&color=black&color=brown"},
+		{"", nil, false, styleObject, "B=150&G=200&R=100"},
+		{StyleForm, boolPtr(false), false, "", "color="},
+		{StyleForm, boolPtr(false), false, styleArray, "color=blue,black,brown"},
+		{StyleForm, boolPtr(false), false, styleObject, "color=B,150,G,200,R,100"},
+		{StyleSpaceDelimited, boolPtr(false), false, styleArray, "color=blue%20black%20brown"},
+		{StyleSpaceDelimited, boolPtr(false), false, styleObject, "color=B%20150%20G%20200%20R%20100"},
+		{StylePipeDelimited, boolPtr(false), false, styleArray, "color=blue|black|brown"},
+		{StylePipeDelimited, boolPtr(false), false, styleObject, "color=B|150|G|200|R|100"},
+		{StyleDeepObject, boolPtr(true), false, styleObject, "color[B]=150&color[G]=200&color[R]=100"},
+		{StyleDeepObject, nil, false, map[string]any{"size": map[string]any{"min": 1}}, "color[size][min]=1"},
+		// Reserved characters
+		{StyleForm, boolPtr(false), false, []any{"a,b", "c&d"}, "color=a%2Cb,c%26d"},
+		{"", nil, false, "x/y?z", "color=x%2Fy%3Fz"},
+		{"", nil, true, "x/y?z", "color=x/y?z"},
+	}
+	for _, tt := range tests {
+		p := &Parameter{Name: "color", In: "query", Style: tt.style, Explode: tt.explode, AllowReserved: tt.allowReserved}
+		pairs, err := serializeQueryParam(p, tt.value)
+		if err != nil {
+			t.Errorf("%s %v: %v", tt.style, tt.value, err)
+			continue
+		}
+		if got := strings.Join(pairs, "&"); got != tt.want {
+			t.Errorf("%s explode=%v %v: expected %q, got %q", tt.style, p.explode(), tt.value, tt.want, got)
+		}
+	}
+
+	if _, err := serializeQueryParam(&Parameter{Name: "color", In: "query", Style: StyleDeepObject}, styleArray); err == nil {
+		t.Errorf("Expected an error for deepObject with an array")
+	}
+	if _, err := serializeQueryParam(&Parameter{Name: "color", In: "query"}, []any{styleArray}); err == nil {
+		t.Errorf("Expected an error for nested arrays")
+	}
+}
+
+func TestSerializeHeaderAndCookieParam(t *testing.T) {
+	headers := []struct {
+		explode bool
+		value   any
+		want    string
+	}{
+		{false, styleString, "blue"},
+		{false, styleArray, "blue,black,brown"},
+		{false, styleObject, "B,150,G,200,R,100"},
+		{true, styleArray, "blue,black,brown"},
+		{true, styleObject, "B=150,G=200,R=100"},
+	}
+	for _, tt := range headers {
+		explode := tt.explode
+		got, err := serializeHeaderParam(&Parameter{Name: "X-Color", In: "header", Explode: &explode}, tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("header explode=%v %v: expected %q, got %q (%v)", tt.explode, tt.value, tt.want, got, err)
+		}
+	}
+
+	cookies := []struct {
+		explode *bool
+		value   any
+		want    string
+	}{
+		{nil, styleString, "color=blue"},
+		{boolPtr(false), styleArray, `color="blue,black,brown"`},
+		{nil, styleArray, "color=blue; color=black; color=brown"},
+		{nil, styleObject, "B=150; G=200; R=100"},
+	}
+	for _, tt := range cookies {
+		got, err := serializeCookieParam(&Parameter{Name: "color", In: "cookie", Explode: tt.explode}, tt.value)
+		if err != nil {
+			t.Errorf("cookie %v: %v", tt.value, err)
+			continue
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range got {
+			req.AddCookie(c)
+		}
+		if h := req.Header.Get("Cookie"); h != tt.want {
+			t.Errorf("cookie %v: expected %q, got %q", tt.value, tt.want, h)
+		}
+	}
+}
+
+func TestExecuteFunctionParamStyles(t *testing.T) {
+	var gotPath, gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.EscapedPath(), r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	spec := &OpenAPISpec{
+		OpenAPI: "3.0.0",
+		Paths: map[string]PathItem{
+			"/colors/{color}": {Get: &Operation{
+				OperationID: "getColors",
+				Parameters: []Parameter{
+					{Name: "color", In: "path", Required: true, Style: StyleMatrix, Explode: boolPtr(true), Schema: &Schema{Type: "array", Items: &Schema{Type: "string"}}},
+					{Name: "tags", In: "query", Style: StylePipeDelimited, Explode: boolPtr(false), Schema: &Schema{Type: "array", Items: &Schema{Type: "string"}}},
+					{Name: "filter", In: "query", Style: StyleDeepObject, Schema: &Schema{Type: "object"}},
+					{Name: "limit", In: "query", Schema: &Schema{Type: "integer"}},
+				},
+			}},
+		},
+	}
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	_, err = ExecuteFunction(client, functions["getColors"], map[string]any{
+		"color":  []any{"blue", "black"},
+		"tags":   []any{"a", "b"},
+		"filter": map[string]any{"name": "x y"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+
+	if gotPath != "/colors/;color=blue;color=black" {
+		t.Errorf("Unexpected path %q", gotPath)
+	}
+	if gotQuery != "tags=a|b&filter[name]=x%20y" {
+		t.Errorf("Unexpected query %q", gotQuery)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,149 @@
+package apiai
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ServerVariable is a variable of a server URL template
+type ServerVariable struct {
+	Enum        []string `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Default     string   `json:"default" yaml:"default"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// ServerSelection picks a server from a servers list
+type ServerSelection struct {
+	Index       int               // position of the server, used when Description is empty
+	Description string            // picks the first server with this description, case-insensitive
+	Variables   map[string]string // overrides of the variable defaults
+
+	// DocumentURL is the URL the spec was loaded from, relative server URLs
+	// such as the default "/" are resolved against it
+	DocumentURL string
+}
+
+// SelectServerURL picks a server and substitutes its variables, overrides must be
+// one of the enum values when the variable has an enum
+func SelectServerURL(servers []Server, sel ServerSelection) (string, error) {
+	server, err := selectServer(servers, sel)
+	if err != nil {
+		return "", err
+	}
+	return server.ExpandURL(sel.Variables)
+}
+
+func selectServer(servers []Server, sel ServerSelection) (*Server, error) {
+	if sel.Description != "" {
+		i := slices.IndexFunc(servers, func(s Server) bool {
+			return strings.EqualFold(s.Description, sel.Description)
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("no server with description %q", sel.Description)
+		}
+		return &servers[i], nil
+	}
+	if sel.Index < 0 || sel.Index >= len(servers) {
+		return nil, fmt.Errorf("server index %d out of range, %d servers defined", sel.Index, len(servers))
+	}
+	return &servers[sel.Index], nil
+}
+
+// ExpandURL substitutes the variables of the server URL, using the defaults
+// for variables not in overrides
+func (s *Server) ExpandURL(overrides map[string]string) (string, error) {
+	u := s.URL
+	for name, variable := range s.Variables {
+		value, ok := overrides[name]
+		if !ok {
+			value = variable.Default
+		} else if len(variable.Enum) > 0 && !slices.Contains(variable.Enum, value) {
+			return "", fmt.Errorf("server variable %q: %q is not one of %v", name, value, variable.Enum)
+		}
+		u = strings.ReplaceAll(u, "{"+name+"}", value)
+	}
+	if i := strings.IndexByte(u, '{'); i >= 0 && strings.IndexByte(u[i:], '}') > 0 {
+		return "", fmt.Errorf("server URL %q has undefined variables", u)
+	}
+	return u, nil
+}
+
+// NewAPIClientFromSpec creates an API client for a server of the spec. Specs
+// without servers use the OpenAPI default "/". Relative server URLs, e.g. the
+// basePath of a Swagger 2.0 spec without host, require sel.DocumentURL.
+func NewAPIClientFromSpec(spec *OpenAPISpec, sel ServerSelection, authConfig *AuthConfig, opts ...func(*http.Client)) (*APIClient, error) {
+	servers := spec.Servers
+	if len(servers) == 0 {
+		servers = []Server{{URL: "/"}}
+	}
+	serverURL, err := SelectServerURL(servers, sel)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() {
+		if sel.DocumentURL == "" {
+			return nil, fmt.Errorf("server URL %q is relative, set ServerSelection.DocumentURL to resolve it", serverURL)
+		}
+		doc, err := url.Parse(sel.DocumentURL)
+		if err != nil {
+			return nil, fmt.Errorf("document URL: %w", err)
+		}
+		if !doc.IsAbs() {
+			return nil, fmt.Errorf("document URL %q is relative", sel.DocumentURL)
+		}
+		serverURL = doc.ResolveReference(u).String()
+	}
+
+	client, err := NewAPIClient(serverURL, authConfig, opts...)
+	if err != nil {
+		return nil, err
+	}
+	client.Server = sel
+	return client, nil
+}
+
+// baseURL returns the URL operation paths are joined to: the server of the
+// function when the operation or its path overrides the servers, picked
+// by the client selection description or the first one, else the client base URL.
+// Relative servers resolve against Server.DocumentURL when set.
+func (c *APIClient) baseURL(fn *FunctionDefinition) (*url.URL, error) {
+	if len(fn.Servers) == 0 {
+		return c.BaseURL, nil
+	}
+
+	sel := ServerSelection{Variables: c.Server.Variables}
+	if c.Server.Description != "" && slices.ContainsFunc(fn.Servers, func(s Server) bool {
+		return strings.EqualFold(s.Description, c.Server.Description)
+	}) {
+		sel.Description = c.Server.Description
+	}
+	serverURL, err := SelectServerURL(fn.Servers, sel)
+	if err != nil {
+		return nil, fmt.Errorf("%s server: %w", fn.Name, err)
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s server: %w", fn.Name, err)
+	}
+	// Relative server URLs are relative to the spec document, or to the client
+	// base URL when the document URL is not known
+	if !u.IsAbs() {
+		base := c.BaseURL
+		if c.Server.DocumentURL != "" {
+			if base, err = url.Parse(c.Server.DocumentURL); err != nil {
+				return nil, fmt.Errorf("%s server: document URL: %w", fn.Name, err)
+			}
+		}
+		if base != nil {
+			u = base.ResolveReference(u)
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,190 @@
+package apiai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const serversSpec = `
+openapi: 3.0.0
+info:
+  title: Regions
+  version: 1.0.0
+servers:
+  - url: https://{region}.api.example.com/{version}
+    description: Production
+    variables:
+      region:
+        enum: [eu, us]
+        default: eu
+      version:
+        default: v1
+  - url: https://sandbox.example.com/v1
+    description: Sandbox
+paths:
+  /pets:
+    get:
+      operationId: listPets
+  /files:
+    servers:
+      - url: https://files.example.com
+    get:
+      operationId: listFiles
+    post:
+      operationId: uploadFile
+      servers:
+        - url: https://upload.example.com
+`
+
+func TestSelectServerURL(t *testing.T) {
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(serversSpec))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+
+	tests := []struct {
+		sel  ServerSelection
+		want string
+		err  string
+	}{
+		{ServerSelection{}, "https://eu.api.example.com/v1", ""},
+		{ServerSelection{Variables: map[string]string{"region": "us", "version": "v2"}}, "https://us.api.example.com/v2", ""},
+		{ServerSelection{Index: 1}, "https://sandbox.example.com/v1", ""},
+		{ServerSelection{Description: "sandbox"}, "https://sandbox.example.com/v1", ""},
+		{ServerSelection{Variables: map[string]string{"region": "mars"}}, "", "not one of"},
+		{ServerSelection{Index: 2}, "", "out of range"},
+		{ServerSelection{Description: "Staging"}, "", "no server"},
+	}
+	for _, tt := range tests {
+		got, err := SelectServerURL(spec.Servers, tt.sel)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%+v: expected error %q, got %v", tt.sel, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%+v: expected %q, got %q (%v)", tt.sel, tt.want, got, err)
+		}
+	}
+
+	client, err := NewAPIClientFromSpec(spec, ServerSelection{Variables: map[string]string{"region": "us"}}, &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if client.BaseURL.String() != "https://us.api.example.com/v1" {
+		t.Errorf("Unexpected base URL %q", client.BaseURL)
+	}
+
+	if _, err := NewAPIClientFromSpec(&OpenAPISpec{Servers: []Server{{URL: "/v1"}}}, ServerSelection{}, &AuthConfig{Type: AuthTypeNone}); err == nil || !strings.Contains(err.Error(), "DocumentURL") {
+		t.Errorf("Expected an error for a relative server URL, got %v", err)
+	}
+}
+
+func TestNewAPIClientFromSpecRelativeServers(t *testing.T) {
+	swagger, err := UnmarshalOpenAPISpec([]byte(`{
+		"swagger": "2.0",
+		"info": {"title": "Pets", "version": "1.0.0"},
+		"basePath": "/v2",
+		"paths": {}
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal spec: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		spec *OpenAPISpec
+		want string
+	}{
+		{"default server", &OpenAPISpec{}, "https://docs.example.com/"},
+		{"root server", &OpenAPISpec{Servers: []Server{{URL: "/"}}}, "https://docs.example.com/"},
+		{"relative path", &OpenAPISpec{Servers: []Server{{URL: "../api"}}}, "https://docs.example.com/api"},
+		{"swagger basePath", swagger, "https://docs.example.com/v2"},
+	}
+	sel := ServerSelection{DocumentURL: "https://docs.example.com/specs/openapi.json"}
+	for _, tt := range tests {
+		client, err := NewAPIClientFromSpec(tt.spec, sel, &AuthConfig{Type: AuthTypeNone})
+		if err != nil {
+			t.Fatalf("%s: failed to create client: %v", tt.name, err)
+		}
+		if client.BaseURL.String() != tt.want {
+			t.Errorf("%s: expected base URL %q, got %q", tt.name, tt.want, client.BaseURL)
+		}
+	}
+}
+
+func TestExecuteFunctionServerOverride(t *testing.T) {
+	spec, err := UnmarshalOpenAPISpecFromYAML([]byte(serversSpec))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal YAML: %v", err)
+	}
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+
+	if len(functions["listPets"].Servers) != 0 {
+		t.Errorf("Expected no server override for listPets")
+	}
+	if s := functions["listFiles"].Servers; len(s) != 1 || s[0].URL != "https://files.example.com" {
+		t.Errorf("Expected path level server, got %+v", s)
+	}
+	if s := functions["uploadFile"].Servers; len(s) != 1 || s[0].URL != "https://upload.example.com" {
+		t.Errorf("Expected operation level server, got %+v", s)
+	}
+
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL+"/v1", &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	// Operation servers are used instead of the base URL, relative ones resolve against it
+	fn := functions["uploadFile"]
+	fn.Servers = []Server{{URL: "/{version}/uploads", Variables: map[string]ServerVariable{"version": {Default: "v2"}}}}
+	if _, err := ExecuteFunction(client, fn, nil); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	if gotPath != "/v2/uploads/files" {
+		t.Errorf("Unexpected path %q", gotPath)
+	}
+
+	client.Server.Variables = map[string]string{"version": "v3"}
+	if _, err := ExecuteFunction(client, fn, nil); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	if gotPath != "/v3/uploads/files" {
+		t.Errorf("Unexpected path %q", gotPath)
+	}
+
+	// With the document URL known, relative servers resolve against it
+	fn.Servers = []Server{{URL: "v2"}}
+	for _, tt := range []struct{ documentURL, want string }{
+		{"", "/v2/files"},
+		{srv.URL + "/specs/openapi.yaml", "/specs/v2/files"},
+	} {
+		client.Server.DocumentURL = tt.documentURL
+		if _, err := ExecuteFunction(client, fn, nil); err != nil {
+			t.Fatalf("Failed to execute function: %v", err)
+		}
+		if gotPath != tt.want {
+			t.Errorf("Document URL %q: expected path %q, got %q", tt.documentURL, tt.want, gotPath)
+		}
+	}
+
+	if _, err := ExecuteFunction(client, functions["listPets"], nil); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	if gotPath != "/v1/pets" {
+		t.Errorf("Unexpected path %q", gotPath)
+	}
+}
@@ -0,0 +1,178 @@
+package apiai
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeNow is the clock of request signatures, replaced in tests
+var timeNow = time.Now
+
+// isSigningAuth reports whether the auth type signs the request, signatures
+// are applied after the other credentials so they cover them
+func isSigningAuth(t AuthType) bool {
+	return t == AuthTypeHMAC || t == AuthTypeAWSSigV4
+}
+
+// bufferBody reads the request body so it can be hashed, the request keeps
+// a replayable copy. It returns nil for requests without a body.
+func bufferBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.ContentLength = int64(len(data))
+	return data, nil
+}
+
+// hashHex returns the hex SHA-256 of data
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with the key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signHMAC signs the request with HMAC-SHA256 over the method, the escaped
+// path and query, the unix timestamp and the hex SHA-256 of the body,
+// separated by newlines:
+//
+//	X-Timestamp: 1440938160
+//	X-Content-SHA256: e3b0c442...
+//	Authorization: HMAC-SHA256 Credential=<AccessKeyID>, Signature=<hex>
+func signHMAC(req *http.Request, config *AuthConfig) error {
+	body, err := bufferBody(req)
+	if err != nil {
+		return err
+	}
+	bodyHash := hashHex(body)
+	timestamp := strconv.FormatInt(timeNow().Unix(), 10)
+
+	target := req.URL.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	stringToSign := strings.Join([]string{req.Method, target, timestamp, bodyHash}, "\n")
+	signature := hex.EncodeToString(hmacSHA256([]byte(config.SecretAccessKey), stringToSign))
+
+	req.Header.Set("X-Timestamp", timestamp)
+	req.Header.Set("X-Content-SHA256", bodyHash)
+	req.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 Credential=%s, Signature=%s", config.AccessKeyID, signature))
+	return nil
+}
+
+// signSigV4 signs the request with AWS Signature Version 4, covering the
+// host, content type, date and session token headers and the body hash
+func signSigV4(req *http.Request, config *AuthConfig) error {
+	if config.Region == "" || config.Service == "" {
+		return fmt.Errorf("SigV4 requires Region and Service")
+	}
+	body, err := bufferBody(req)
+	if err != nil {
+		return err
+	}
+
+	now := timeNow().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", config.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for _, name := range []string{"Content-Type", "X-Amz-Date", "X-Amz-Security-Token"} {
+		if v := req.Header.Get(name); v != "" {
+			headers[strings.ToLower(name)] = strings.Join(strings.Fields(v), " ")
+		}
+	}
+	names := slices.Sorted(maps.Keys(headers))
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4Path(req.URL),
+		sigV4Query(req.URL),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hashHex(body),
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format("20060102"), config.Region, config.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hashHex([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + config.SecretAccessKey)
+	for _, part := range []string{now.Format("20060102"), config.Region, config.Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// sigV4Path encodes each segment of the escaped path again, as services
+// other than S3 expect
+func sigV4Path(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = sigV4Escape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sigV4Query sorts the query parameters by name and value and encodes them strictly
+func sigV4Query(u *url.URL) string {
+	query := u.Query()
+	pairs := make([]string, 0, len(query))
+	for _, name := range slices.Sorted(maps.Keys(query)) {
+		for _, value := range slices.Sorted(slices.Values(query[name])) {
+			pairs = append(pairs, sigV4Escape(name)+"="+sigV4Escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent-encodes everything but the unreserved characters
+func sigV4Escape(s string) string {
+	return percentEncode(s, false)
+}
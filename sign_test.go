@@ -0,0 +1,119 @@
+package apiai
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignSigV4(t *testing.T) {
+	// Vectors of the AWS Signature Version 4 test suite
+	defer func(now func() time.Time) { timeNow = now }(timeNow)
+	timeNow = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+
+	config := &AuthConfig{
+		Type:            AuthTypeAWSSigV4,
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         "service",
+	}
+	tests := []struct {
+		name, method, url, signature string
+	}{
+		{"get-vanilla", http.MethodGet, "https://example.amazonaws.com/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"post-vanilla", http.MethodPost, "https://example.amazonaws.com/", "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+		{"get-vanilla-query-order-key-case", http.MethodGet, "https://example.amazonaws.com/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.url, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := applyAuth(req, config); err != nil {
+			t.Fatalf("%s: failed to sign: %v", tt.name, err)
+		}
+		want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + tt.signature
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.name, want, got)
+		}
+		if req.Header.Get("X-Amz-Date") != "20150830T123600Z" {
+			t.Errorf("%s: unexpected X-Amz-Date %q", tt.name, req.Header.Get("X-Amz-Date"))
+		}
+	}
+
+	if err := applyAuth(&http.Request{}, &AuthConfig{Type: AuthTypeAWSSigV4}); err == nil {
+		t.Errorf("Expected an error without region and service")
+	}
+}
+
+func TestSignHMAC(t *testing.T) {
+	defer func(now func() time.Time) { timeNow = now }(timeNow)
+	timeNow = func() time.Time { return time.Unix(1440938160, 0) }
+
+	var got *http.Request
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got, gotBody = r, string(body)
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL+"/v1", &AuthConfig{Type: AuthTypeHMAC, AccessKeyID: "agent", SecretAccessKey: "topsecret"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	fn := &FunctionDefinition{Name: "addPet", OapiMethod: http.MethodPost, OapiPath: "/pets", QueryParams: []string{"tag"}}
+	_, err = ExecuteFunction(client, fn, map[string]any{"tag": "dog", "requestBody": map[string]any{"name": "Rex"}})
+	if err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+
+	// Known answer computed over "POST\n/v1/pets?tag=dog\n1440938160\n<body hash>"
+	want := map[string]string{
+		"X-Timestamp":      "1440938160",
+		"X-Content-Sha256": "3b7fdbc0b236195b6bf45611b4d3d52dbc54612faeca2cda8696aa9b5ed4ebfa",
+		"Authorization":    "HMAC-SHA256 Credential=agent, Signature=2b9415f6b0e5db8fcb49dd4f87cbfd76905a62f8b8b6c8c3830d51b2538556e4",
+	}
+	for name, value := range want {
+		if got.Header.Get(name) != value {
+			t.Errorf("Expected %s %q, got %q", name, value, got.Header.Get(name))
+		}
+	}
+	if gotBody != `{"name":"Rex"}` || got.ContentLength != int64(len(gotBody)) {
+		t.Errorf("Unexpected body %q with length %d", gotBody, got.ContentLength)
+	}
+}
+
+func TestSignAfterQueryKey(t *testing.T) {
+	defer func(now func() time.Time) { timeNow = now }(timeNow)
+	timeNow = func() time.Time { return time.Unix(1440938160, 0) }
+
+	registry, err := NewCredentialRegistry(nil)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	// Sorted by name the signature comes first, it must still cover the key
+	registry.Set("a-signature", &AuthConfig{Type: AuthTypeHMAC, AccessKeyID: "agent", SecretAccessKey: "topsecret"})
+	registry.Set("b-key", &AuthConfig{Type: AuthTypeAPIKeyQuery, APIKeyName: "key", APIKeyValue: "k"})
+
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer srv.Close()
+
+	client, _ := NewAPIClient(srv.URL, nil, WithCredentialRegistry(registry))
+	fn := &FunctionDefinition{Name: "get", OapiMethod: http.MethodGet, OapiPath: "/", Security: []SecurityRequirement{{"a-signature": nil, "b-key": nil}}}
+	if _, err := ExecuteFunction(client, fn, nil); err != nil {
+		t.Fatalf("Failed to execute function: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?key=k", nil)
+	signHMAC(req, &AuthConfig{AccessKeyID: "agent", SecretAccessKey: "topsecret"})
+	if got.URL.RawQuery != "key=k" || got.Header.Get("Authorization") != req.Header.Get("Authorization") {
+		t.Errorf("Expected the signature to cover the query key, got %q %q", got.URL.RawQuery, got.Header.Get("Authorization"))
+	}
+}
@@ -0,0 +1,460 @@
+package apiai
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// swagger2Spec represents a Swagger 2.0 specification,
+// it is only used to upgrade such documents to OpenAPISpec
+type swagger2Spec struct {
+	Swagger             string                             `json:"swagger" yaml:"swagger"`
+	Info                Info                               `json:"info" yaml:"info"`
+	Host                string                             `json:"host,omitempty" yaml:"host,omitempty"`
+	BasePath            string                             `json:"basePath,omitempty" yaml:"basePath,omitempty"`
+	Schemes             []string                           `json:"schemes,omitempty" yaml:"schemes,omitempty"`
+	Consumes            []string                           `json:"consumes,omitempty" yaml:"consumes,omitempty"`
+	Produces            []string                           `json:"produces,omitempty" yaml:"produces,omitempty"`
+	Paths               map[string]swagger2PathItem        `json:"paths" yaml:"paths"`
+	Definitions         map[string]*Schema                 `json:"definitions,omitempty" yaml:"definitions,omitempty"`
+	Parameters          map[string]swagger2Parameter       `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Responses           map[string]*swagger2Response       `json:"responses,omitempty" yaml:"responses,omitempty"`
+	SecurityDefinitions map[string]*swagger2SecurityScheme `json:"securityDefinitions,omitempty" yaml:"securityDefinitions,omitempty"`
+	Security            []SecurityRequirement              `json:"security,omitempty" yaml:"security,omitempty"`
+}
+
+type swagger2PathItem struct {
+	Get        *swagger2Operation  `json:"get" yaml:"get"`
+	Post       *swagger2Operation  `json:"post" yaml:"post"`
+	Put        *swagger2Operation  `json:"put" yaml:"put"`
+	Delete     *swagger2Operation  `json:"delete" yaml:"delete"`
+	Patch      *swagger2Operation  `json:"patch" yaml:"patch"`
+	Head       *swagger2Operation  `json:"head,omitempty" yaml:"head,omitempty"`
+	Options    *swagger2Operation  `json:"options,omitempty" yaml:"options,omitempty"`
+	Parameters []swagger2Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+type swagger2Operation struct {
+	OperationID string              `json:"operationId,omitempty" yaml:"operationId,omitempty"`
+	Summary     string              `json:"summary" yaml:"summary"`
+	Description string              `json:"description" yaml:"description"`
+	Consumes    []string            `json:"consumes,omitempty" yaml:"consumes,omitempty"`
+	Produces    []string            `json:"produces,omitempty" yaml:"produces,omitempty"`
+	Parameters  []swagger2Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+
+	Responses map[string]*swagger2Response `json:"responses,omitempty" yaml:"responses,omitempty"`
+	Security  []SecurityRequirement        `json:"security,omitempty" yaml:"security,omitempty"`
+}
+
+// swagger2Parameter holds the non-body parameter schema inline, next to the parameter fields
+type swagger2Parameter struct {
+	Name        string  `json:"name" yaml:"name"`
+	In          string  `json:"in" yaml:"in"`
+	Description string  `json:"description" yaml:"description"`
+	Required    bool    `json:"required" yaml:"required"`
+	Schema      *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Ref         string  `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+
+	Type             string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Format           string   `json:"format,omitempty" yaml:"format,omitempty"`
+	Items            *Schema  `json:"items,omitempty" yaml:"items,omitempty"`
+	CollectionFormat string   `json:"collectionFormat,omitempty" yaml:"collectionFormat,omitempty"`
+	Enum             []any    `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Default          any      `json:"default,omitempty" yaml:"default,omitempty"`
+	Minimum          *float64 `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	ExclusiveMinimum bool     `json:"exclusiveMinimum,omitempty" yaml:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum bool     `json:"exclusiveMaximum,omitempty" yaml:"exclusiveMaximum,omitempty"`
+	MultipleOf       *float64 `json:"multipleOf,omitempty" yaml:"multipleOf,omitempty"`
+	MinLength        *int     `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength        *int     `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	Pattern          string   `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	MinItems         *int     `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+	MaxItems         *int     `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+	UniqueItems      bool     `json:"uniqueItems,omitempty" yaml:"uniqueItems,omitempty"`
+}
+
+type swagger2Response struct {
+	Description string             `json:"description" yaml:"description"`
+	Schema      *Schema            `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Headers     map[string]*Schema `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Ref         string             `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+}
+
+type swagger2SecurityScheme struct {
+	Type             string            `json:"type" yaml:"type"`
+	Description      string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Name             string            `json:"name,omitempty" yaml:"name,omitempty"`
+	In               string            `json:"in,omitempty" yaml:"in,omitempty"`
+	Flow             string            `json:"flow,omitempty" yaml:"flow,omitempty"`
+	AuthorizationURL string            `json:"authorizationUrl,omitempty" yaml:"authorizationUrl,omitempty"`
+	TokenURL         string            `json:"tokenUrl,omitempty" yaml:"tokenUrl,omitempty"`
+	Scopes           map[string]string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+}
+
+// toOpenAPI upgrades the Swagger 2.0 document to the OpenAPI 3 model:
+// body and formData parameters become request bodies, definitions become
+// components.schemas and host/basePath/schemes become servers.
+func (sw *swagger2Spec) toOpenAPI() (*OpenAPISpec, error) {
+	spec := &OpenAPISpec{
+		OpenAPI:    "3.0.3",
+		Info:       sw.Info,
+		Servers:    sw.servers(),
+		Paths:      map[string]PathItem{},
+		Components: &Components{},
+		Security:   sw.Security,
+	}
+
+	if len(sw.Definitions) > 0 {
+		spec.Components.Schemas = sw.Definitions
+	}
+
+	for name, param := range sw.Parameters {
+		// Body and formData parameters have no 3.0 counterpart in components.parameters,
+		// they are inlined into request bodies of the operations referencing them
+		if param.In == "body" || param.In == "formData" {
+			continue
+		}
+		if spec.Components.Parameters == nil {
+			spec.Components.Parameters = map[string]Parameter{}
+		}
+		spec.Components.Parameters[name] = param.toParameter()
+	}
+
+	for name, resp := range sw.Responses {
+		if spec.Components.Responses == nil {
+			spec.Components.Responses = map[string]*Response{}
+		}
+		spec.Components.Responses[name] = resp.toResponse(sw.Produces)
+	}
+
+	for name, scheme := range sw.SecurityDefinitions {
+		if spec.Components.SecuritySchemes == nil {
+			spec.Components.SecuritySchemes = map[string]*SecurityScheme{}
+		}
+		spec.Components.SecuritySchemes[name] = scheme.toSecurityScheme()
+	}
+
+	for path, item := range sw.Paths {
+		var pathItem PathItem
+		ops := []struct {
+			src *swagger2Operation
+			dst **Operation
+		}{
+			{item.Get, &pathItem.Get},
+			{item.Post, &pathItem.Post},
+			{item.Put, &pathItem.Put},
+			{item.Delete, &pathItem.Delete},
+			{item.Patch, &pathItem.Patch},
+			{item.Head, &pathItem.Head},
+			{item.Options, &pathItem.Options},
+		}
+		for _, op := range ops {
+			if op.src == nil {
+				continue
+			}
+			converted, err := sw.convertOperation(op.src, item.Parameters)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			*op.dst = converted
+		}
+		spec.Paths[path] = pathItem
+	}
+
+	// References to Swagger 2.0 locations are moved to their components
+	err := walkSchemas(reflect.ValueOf(spec), map[*Schema]bool{}, func(schema *Schema) error {
+		schema.Ref = upgradeSwagger2Ref(schema.Ref)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// servers builds server URLs from host, basePath and schemes
+func (sw *swagger2Spec) servers() []Server {
+	if sw.Host == "" && sw.BasePath == "" {
+		return nil
+	}
+	if sw.Host == "" {
+		return []Server{{URL: sw.BasePath}}
+	}
+
+	schemes := sw.Schemes
+	if len(schemes) == 0 {
+		schemes = []string{"https"}
+	}
+	servers := make([]Server, 0, len(schemes))
+	for _, scheme := range schemes {
+		servers = append(servers, Server{URL: scheme + "://" + sw.Host + sw.BasePath})
+	}
+	return servers
+}
+
+func (sw *swagger2Spec) convertOperation(src *swagger2Operation, pathParams []swagger2Parameter) (*Operation, error) {
+	op := &Operation{
+		OperationID: src.OperationID,
+		Summary:     src.Summary,
+		Description: src.Description,
+		Security:    src.Security,
+	}
+
+	// Path level parameters apply unless the operation overrides them by name and location
+	var params []swagger2Parameter
+	for _, p := range pathParams {
+		resolved, err := sw.resolveParameter(p)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, resolved)
+	}
+	for _, p := range src.Parameters {
+		resolved, err := sw.resolveParameter(p)
+		if err != nil {
+			return nil, err
+		}
+		params = slices.DeleteFunc(params, func(existing swagger2Parameter) bool {
+			return existing.Name == resolved.Name && existing.In == resolved.In
+		})
+		params = append(params, resolved)
+	}
+
+	consumes := src.Consumes
+	if len(consumes) == 0 {
+		consumes = sw.Consumes
+	}
+
+	var formData []swagger2Parameter
+	for _, p := range params {
+		switch p.In {
+		case "body":
+			op.RequestBody = p.toRequestBody(consumes)
+		case "formData":
+			formData = append(formData, p)
+		default:
+			op.Parameters = append(op.Parameters, p.toParameter())
+		}
+	}
+
+	if len(formData) > 0 && op.RequestBody == nil {
+		op.RequestBody = formDataRequestBody(formData, consumes)
+	}
+
+	produces := src.Produces
+	if len(produces) == 0 {
+		produces = sw.Produces
+	}
+	for code, resp := range src.Responses {
+		if resp == nil {
+			continue
+		}
+		if op.Responses == nil {
+			op.Responses = map[string]*Response{}
+		}
+		op.Responses[code] = resp.toResponse(produces)
+	}
+
+	return op, nil
+}
+
+// resolveParameter inlines a reference to the global parameters section,
+// so body and formData parameters can be turned into request bodies
+func (sw *swagger2Spec) resolveParameter(p swagger2Parameter) (swagger2Parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	name, ok := strings.CutPrefix(p.Ref, "#/parameters/")
+	if !ok {
+		return p, fmt.Errorf("unsupported parameter $ref %q", p.Ref)
+	}
+	tokens, err := parseRefPointer("#/" + name)
+	if err != nil || len(tokens) != 1 {
+		return p, fmt.Errorf("invalid parameter $ref %q", p.Ref)
+	}
+	resolved, ok := sw.Parameters[tokens[0]]
+	if !ok {
+		return p, fmt.Errorf("unresolved $ref %q", p.Ref)
+	}
+	return resolved, nil
+}
+
+func (p swagger2Parameter) toParameter() Parameter {
+	param := Parameter{
+		Name:        p.Name,
+		In:          p.In,
+		Description: p.Description,
+		Required:    p.Required,
+		Schema:      p.schema(),
+	}
+	param.Style, param.Explode = p.style()
+	return param
+}
+
+// style maps collectionFormat of array parameters to the equivalent style and explode
+func (p swagger2Parameter) style() (string, *bool) {
+	if p.Type != "array" {
+		return "", nil
+	}
+	explode := false
+	if p.In != "query" && p.In != "formData" {
+		// Only csv is possible outside of the query
+		return StyleSimple, &explode
+	}
+	switch p.CollectionFormat {
+	case "ssv":
+		return StyleSpaceDelimited, &explode
+	case "pipes":
+		return StylePipeDelimited, &explode
+	case "multi":
+		explode = true
+	}
+	// csv, and tsv that has no OpenAPI 3 equivalent
+	return StyleForm, &explode
+}
+
+// schema builds a schema from the inline type keywords of a non-body parameter
+func (p swagger2Parameter) schema() *Schema {
+	schema := &Schema{
+		Type:             p.Type,
+		Format:           p.Format,
+		Items:            p.Items,
+		Enum:             p.Enum,
+		Default:          p.Default,
+		Minimum:          p.Minimum,
+		Maximum:          p.Maximum,
+		ExclusiveMinimum: p.ExclusiveMinimum,
+		ExclusiveMaximum: p.ExclusiveMaximum,
+		MultipleOf:       p.MultipleOf,
+		MinLength:        p.MinLength,
+		MaxLength:        p.MaxLength,
+		Pattern:          p.Pattern,
+		MinItems:         p.MinItems,
+		MaxItems:         p.MaxItems,
+		UniqueItems:      p.UniqueItems,
+	}
+	if p.Type == "file" {
+		schema.Type = "string"
+		schema.Format = "binary"
+	}
+	return schema
+}
+
+func (p swagger2Parameter) toRequestBody(consumes []string) *RequestBody {
+	if len(consumes) == 0 {
+		consumes = []string{"application/json"}
+	}
+	body := &RequestBody{
+		Description: p.Description,
+		Required:    p.Required,
+		Content:     map[string]MediaType{},
+	}
+	for _, mediaType := range consumes {
+		body.Content[mediaType] = MediaType{Schema: p.Schema}
+	}
+	return body
+}
+
+// formDataRequestBody combines formData parameters into a single object schema
+func formDataRequestBody(params []swagger2Parameter, consumes []string) *RequestBody {
+	schema := &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{},
+	}
+	multipart := slices.Contains(consumes, "multipart/form-data")
+	for _, p := range params {
+		prop := p.schema()
+		prop.Description = p.Description
+		schema.Properties[p.Name] = prop
+		if p.Required {
+			schema.Required = append(schema.Required, p.Name)
+		}
+		if p.Type == "file" {
+			multipart = true
+		}
+	}
+
+	mediaType := "application/x-www-form-urlencoded"
+	if multipart {
+		mediaType = "multipart/form-data"
+	}
+	return &RequestBody{
+		Content: map[string]MediaType{
+			mediaType: {Schema: schema},
+		},
+	}
+}
+
+func (r *swagger2Response) toResponse(produces []string) *Response {
+	resp := &Response{
+		Description: r.Description,
+		Ref:         upgradeSwagger2Ref(r.Ref),
+	}
+	if r.Schema != nil {
+		if len(produces) == 0 {
+			produces = []string{"application/json"}
+		}
+		resp.Content = map[string]MediaType{}
+		for _, mediaType := range produces {
+			resp.Content[mediaType] = MediaType{Schema: r.Schema}
+		}
+	}
+	for name, header := range r.Headers {
+		if resp.Headers == nil {
+			resp.Headers = map[string]*Header{}
+		}
+		resp.Headers[name] = &Header{Description: header.Description, Schema: header}
+	}
+	return resp
+}
+
+func (s *swagger2SecurityScheme) toSecurityScheme() *SecurityScheme {
+	scheme := &SecurityScheme{
+		Type:        s.Type,
+		Description: s.Description,
+	}
+	switch s.Type {
+	case "basic":
+		scheme.Type = "http"
+		scheme.Scheme = "basic"
+	case "apiKey":
+		scheme.Name = s.Name
+		scheme.In = s.In
+	case "oauth2":
+		flow := &OAuthFlow{
+			AuthorizationURL: s.AuthorizationURL,
+			TokenURL:         s.TokenURL,
+			Scopes:           s.Scopes,
+		}
+		scheme.Flows = &OAuthFlows{}
+		switch s.Flow {
+		case "implicit":
+			scheme.Flows.Implicit = flow
+		case "password":
+			scheme.Flows.Password = flow
+		case "application":
+			scheme.Flows.ClientCredentials = flow
+		case "accessCode":
+			scheme.Flows.AuthorizationCode = flow
+		}
+	}
+	return scheme
+}
+
+// upgradeSwagger2Ref maps Swagger 2.0 reference locations to OpenAPI 3 components
+func upgradeSwagger2Ref(ref string) string {
+	for from, to := range map[string]string{
+		"#/definitions/": "#/components/schemas/",
+		"#/parameters/":  "#/components/parameters/",
+		"#/responses/":   "#/components/responses/",
+	} {
+		if rest, ok := strings.CutPrefix(ref, from); ok {
+			return to + rest
+		}
+	}
+	return ref
+}
@@ -0,0 +1,205 @@
+package apiai
+
+import (
+	"testing"
+)
+
+const swagger2PetStore = `
+swagger: "2.0"
+info:
+  title: Legacy Pets
+  version: 1.0.0
+host: pets.example.com
+basePath: /v1
+schemes: [https, http]
+consumes: [application/json]
+parameters:
+  PetID:
+    name: petId
+    in: path
+    required: true
+    type: integer
+    format: int64
+  PetBody:
+    name: pet
+    in: body
+    required: true
+    schema:
+      $ref: '#/definitions/Pet'
+responses:
+  Error:
+    description: Unexpected error
+    schema:
+      type: object
+      properties:
+        message:
+          type: string
+securityDefinitions:
+  basicAuth:
+    type: basic
+  apiKey:
+    type: apiKey
+    name: X-API-Key
+    in: header
+  oauth:
+    type: oauth2
+    flow: application
+    tokenUrl: https://pets.example.com/token
+    scopes:
+      pets:read: Read pets
+definitions:
+  Pet:
+    type: object
+    required: [name]
+    properties:
+      name:
+        type: string
+      owner:
+        $ref: '#/definitions/Owner'
+  Owner:
+    type: object
+    properties:
+      email:
+        type: string
+paths:
+  /pets:
+    post:
+      summary: Add a pet
+      parameters:
+        - $ref: '#/parameters/PetBody'
+    get:
+      summary: List pets
+      produces: [application/json, application/xml]
+      responses:
+        200:
+          description: The pets
+          schema:
+            type: array
+            items:
+              $ref: '#/definitions/Pet'
+        default:
+          $ref: '#/responses/Error'
+      parameters:
+        - name: status
+          in: query
+          type: array
+          items:
+            type: string
+            enum: [available, sold]
+          collectionFormat: multi
+  /pets/{petId}:
+    parameters:
+      - $ref: '#/parameters/PetID'
+    get:
+      summary: Get a pet
+    put:
+      summary: Update a pet with form data
+      consumes: [application/x-www-form-urlencoded]
+      parameters:
+        - name: name
+          in: formData
+          required: true
+          type: string
+        - name: status
+          in: formData
+          type: string
+  /pets/{petId}/photo:
+    post:
+      summary: Upload a photo
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          type: string
+        - name: file
+          in: formData
+          type: file
+`
+
+func TestSwagger2Upgrade(t *testing.T) {
+	spec, err := UnmarshalOpenAPISpec([]byte(swagger2PetStore))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal Swagger 2.0 spec: %v", err)
+	}
+
+	if spec.OpenAPI != "3.0.3" || spec.Info.Title != "Legacy Pets" {
+		t.Errorf("Unexpected spec header: %s %+v", spec.OpenAPI, spec.Info)
+	}
+
+	if len(spec.Servers) != 2 || spec.Servers[0].URL != "https://pets.example.com/v1" || spec.Servers[1].URL != "http://pets.example.com/v1" {
+		t.Errorf("Unexpected servers: %+v", spec.Servers)
+	}
+
+	if spec.Components.Schemas["Pet"].Properties["owner"].Ref != "#/components/schemas/Owner" {
+		t.Errorf("Expected definitions refs to be rewritten, got %q", spec.Components.Schemas["Pet"].Properties["owner"].Ref)
+	}
+	if _, ok := spec.Components.Parameters["PetBody"]; ok {
+		t.Errorf("Expected body parameter not to be a component parameter")
+	}
+	if p := spec.Components.Parameters["PetID"]; p.Schema == nil || p.Schema.Type != "integer" {
+		t.Errorf("Expected PetID parameter schema, got %+v", p)
+	}
+
+	schemes := spec.Components.SecuritySchemes
+	if schemes["basicAuth"].Type != "http" || schemes["basicAuth"].Scheme != "basic" {
+		t.Errorf("Unexpected basic scheme: %+v", schemes["basicAuth"])
+	}
+	if schemes["apiKey"].Name != "X-API-Key" || schemes["apiKey"].In != "header" {
+		t.Errorf("Unexpected apiKey scheme: %+v", schemes["apiKey"])
+	}
+	if flow := schemes["oauth"].Flows.ClientCredentials; flow == nil || flow.TokenURL != "https://pets.example.com/token" {
+		t.Errorf("Unexpected oauth scheme: %+v", schemes["oauth"].Flows)
+	}
+
+	post := spec.Paths["/pets"].Post
+	if post.RequestBody == nil || !post.RequestBody.Required {
+		t.Fatalf("Expected body parameter to become a required request body, got %+v", post.RequestBody)
+	}
+	if s := post.RequestBody.Content["application/json"].Schema; s == nil || s.Ref != "#/components/schemas/Pet" {
+		t.Errorf("Unexpected request body schema: %+v", s)
+	}
+
+	put := spec.Paths["/pets/{petId}"].Put
+	form := put.RequestBody.Content["application/x-www-form-urlencoded"].Schema
+	if form == nil || len(form.Properties) != 2 || len(form.Required) != 1 || form.Required[0] != "name" {
+		t.Errorf("Unexpected form request body: %+v", form)
+	}
+	if len(put.Parameters) != 1 || put.Parameters[0].Name != "petId" {
+		t.Errorf("Expected path level parameter to be merged, got %+v", put.Parameters)
+	}
+
+	photo := spec.Paths["/pets/{petId}/photo"].Post
+	file := photo.RequestBody.Content["multipart/form-data"].Schema.Properties["file"]
+	if file.Type != "string" || file.Format != "binary" {
+		t.Errorf("Expected file parameter to be a binary string, got %+v", file)
+	}
+
+	functions, err := ConvertOpenAPIToFunctions(spec)
+	if err != nil {
+		t.Fatalf("Failed to convert spec: %v", err)
+	}
+	if len(functions) != 5 {
+		t.Errorf("Expected 5 functions, got %d", len(functions))
+	}
+	body := functions["post_pets"].Parameters.Properties["requestBody"]
+	if body == nil || body.Properties["owner"].Properties["email"] == nil {
+		t.Errorf("Expected Pet definition to be inlined, got %+v", body)
+	}
+	status := functions["get_pets"].Parameters.Properties["status"]
+	if status.Type != "array" || status.Items == nil || len(status.Items.Enum) != 2 {
+		t.Errorf("Unexpected status parameter: %+v", status)
+	}
+	if p := functions["get_pets"].OapiParams["status"]; p.Style != StyleForm || p.Explode == nil || !*p.Explode {
+		t.Errorf("Expected multi collection format to become exploded form, got %+v", p)
+	}
+	list := functions["get_pets"]
+	if r := list.Response(200); r == nil || r.ContentType != "application/json" || r.Schema.Items.Properties["name"] == nil {
+		t.Errorf("Unexpected 200 response: %+v", r)
+	}
+	if r := list.Response(500); r == nil || r.Schema.Properties["message"] == nil {
+		t.Errorf("Expected default response to resolve, got %+v", r)
+	}
+	if len(functions["get_pets_petid"].PathParams) != 1 {
+		t.Errorf("Expected petId path parameter, got %v", functions["get_pets_petid"].PathParams)
+	}
+}
@@ -0,0 +1,420 @@
+package apiai
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation is an argument that does not match the function parameters schema
+type Violation struct {
+	Path    string `json:"path"`    // JSON Pointer to the argument, e.g. "/requestBody/tags/0"
+	Keyword string `json:"keyword"` // schema keyword that failed, e.g. "type" or "required"
+	Message string `json:"message"`
+}
+
+// ValidationError is returned for arguments that do not match the schema.
+// Its message holds the violations as JSON, so it can be sent back
+// as the tool result for the model to correct the call.
+type ValidationError struct {
+	Function   string
+	StatusCode int // set for responses, see ValidateResponse
+	Violations []Violation
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	data, _ := json.Marshal(e.Violations)
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: invalid %d response: %s", e.Function, e.StatusCode, data)
+	}
+	return fmt.Sprintf("%s: invalid arguments: %s", e.Function, data)
+}
+
+// ValidateArguments checks arguments against fn.Parameters and returns *ValidationError
+// listing every violation. With coerce, safe mismatches are fixed instead: numeric
+// and boolean strings are converted and a single value is wrapped into an array.
+// The returned arguments hold the coerced values, the input map is not modified.
+// Null arguments of optional parameters are accepted as absent, as ExecuteFunction
+// does not send them.
+func ValidateArguments(fn *FunctionDefinition, arguments map[string]any, coerce bool) (map[string]any, error) {
+	v := &validator{coerce: coerce}
+
+	args := map[string]any{}
+	var nulls []string
+	for name, value := range arguments {
+		if value == nil && !slices.Contains(fn.Parameters.Required, name) {
+			nulls = append(nulls, name)
+			continue
+		}
+		args[name] = value
+	}
+	result := v.validate(&fn.Parameters, args, "")
+	if len(v.violations) > 0 {
+		return nil, &ValidationError{Function: fn.Name, Violations: v.violations}
+	}
+
+	coerced, _ := result.(map[string]any)
+	for _, name := range nulls {
+		coerced[name] = nil
+	}
+	return coerced, nil
+}
+
+type validator struct {
+	coerce     bool
+	violations []Violation
+}
+
+func (v *validator) fail(path, keyword, format string, args ...any) {
+	v.violations = append(v.violations, Violation{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+}
+
+// check validates value in a separate validator, used for composition keywords
+func (v *validator) check(schema *Schema, value any, path string) (any, []Violation) {
+	sub := &validator{coerce: v.coerce}
+	result := sub.validate(schema, value, path)
+	return result, sub.violations
+}
+
+// validate checks the value and returns it, coerced when enabled
+func (v *validator) validate(schema *Schema, value any, path string) any {
+	if schema == nil {
+		return value
+	}
+
+	if value == nil {
+		if schema.Type != "" && !schema.Nullable {
+			v.fail(path, "type", "expected %s, got null", schema.Type)
+		}
+		return nil
+	}
+
+	if schema.Type != "" {
+		value = v.coerceType(schema, value)
+		if !hasJSONType(value, schema.Type) {
+			v.fail(path, "type", "expected %s, got %s", schema.Type, jsonTypeOf(value))
+			return value
+		}
+	}
+
+	if len(schema.Enum) > 0 && !slices.ContainsFunc(schema.Enum, func(e any) bool { return jsonEqual(e, value) }) {
+		v.fail(path, "enum", "value must be one of %s", mustJSON(schema.Enum))
+	}
+	if schema.Const != nil && !jsonEqual(schema.Const, value) {
+		v.fail(path, "const", "value must be %s", mustJSON(schema.Const))
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		value = v.validateObject(schema, val, path)
+	case []any:
+		value = v.validateArray(schema, val, path)
+	case string:
+		v.validateString(schema, val, path)
+	default:
+		if n, ok := toFloat(value); ok {
+			v.validateNumber(schema, n, path)
+		}
+	}
+
+	return v.validateComposition(schema, value, path)
+}
+
+func (v *validator) validateObject(schema *Schema, obj map[string]any, path string) any {
+	for _, name := range schema.Required {
+		if _, ok := obj[name]; !ok {
+			v.fail(path+"/"+escapePointerToken(name), "required", "missing required property %q", name)
+		}
+	}
+
+	var result map[string]any
+	for _, name := range slices.Sorted(maps.Keys(obj)) {
+		propPath := path + "/" + escapePointerToken(name)
+		value := obj[name]
+
+		var coerced any
+		if prop, ok := schema.Properties[name]; ok {
+			coerced = v.validate(prop, value, propPath)
+		} else if ap := schema.AdditionalProperties; ap != nil {
+			if ap.Schema != nil {
+				coerced = v.validate(ap.Schema, value, propPath)
+			} else if !ap.Allowed {
+				v.fail(propPath, "additionalProperties", "unknown property %q", name)
+				continue
+			} else {
+				coerced = value
+			}
+		} else {
+			coerced = value
+		}
+
+		if result == nil && !sameValue(coerced, value) {
+			result = maps.Clone(obj)
+		}
+		if result != nil {
+			result[name] = coerced
+		}
+	}
+
+	if result != nil {
+		return result
+	}
+	return obj
+}
+
+func (v *validator) validateArray(schema *Schema, items []any, path string) any {
+	if schema.MinItems != nil && len(items) < *schema.MinItems {
+		v.fail(path, "minItems", "expected at least %d items, got %d", *schema.MinItems, len(items))
+	}
+	if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+		v.fail(path, "maxItems", "expected at most %d items, got %d", *schema.MaxItems, len(items))
+	}
+	if schema.UniqueItems {
+		for i := range items {
+			for j := i + 1; j < len(items); j++ {
+				if jsonEqual(items[i], items[j]) {
+					v.fail(path, "uniqueItems", "items %d and %d are equal", i, j)
+				}
+			}
+		}
+	}
+
+	var result []any
+	for i, item := range items {
+		coerced := v.validate(schema.Items, item, path+"/"+strconv.Itoa(i))
+		if result == nil && !sameValue(coerced, item) {
+			result = slices.Clone(items)
+		}
+		if result != nil {
+			result[i] = coerced
+		}
+	}
+
+	if result != nil {
+		return result
+	}
+	return items
+}
+
+func (v *validator) validateString(schema *Schema, s string, path string) {
+	length := utf8.RuneCountInString(s)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		v.fail(path, "minLength", "expected at least %d characters, got %d", *schema.MinLength, length)
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		v.fail(path, "maxLength", "expected at most %d characters, got %d", *schema.MaxLength, length)
+	}
+	if schema.Pattern != "" {
+		// Patterns Go can not compile are not checked
+		if re, err := regexp.Compile(schema.Pattern); err == nil && !re.MatchString(s) {
+			v.fail(path, "pattern", "value must match %q", schema.Pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(schema *Schema, n float64, path string) {
+	if schema.Minimum != nil {
+		if schema.ExclusiveMinimum && n <= *schema.Minimum {
+			v.fail(path, "exclusiveMinimum", "value must be greater than %v", *schema.Minimum)
+		} else if n < *schema.Minimum {
+			v.fail(path, "minimum", "value must be at least %v", *schema.Minimum)
+		}
+	}
+	if schema.Maximum != nil {
+		if schema.ExclusiveMaximum && n >= *schema.Maximum {
+			v.fail(path, "exclusiveMaximum", "value must be less than %v", *schema.Maximum)
+		} else if n > *schema.Maximum {
+			v.fail(path, "maximum", "value must be at most %v", *schema.Maximum)
+		}
+	}
+	if schema.MultipleOf != nil && *schema.MultipleOf > 0 {
+		if q := n / *schema.MultipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "multipleOf", "value must be a multiple of %v", *schema.MultipleOf)
+		}
+	}
+}
+
+func (v *validator) validateComposition(schema *Schema, value any, path string) any {
+	for _, sub := range schema.AllOf {
+		value = v.validate(sub, value, path)
+	}
+
+	if len(schema.AnyOf) > 0 {
+		matched := false
+		for _, sub := range schema.AnyOf {
+			if coerced, violations := v.check(sub, value, path); len(violations) == 0 {
+				value, matched = coerced, true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "anyOf", "value must match at least one of %d schemas", len(schema.AnyOf))
+		}
+	}
+
+	if len(schema.OneOf) > 0 {
+		var matches int
+		var match any
+		for _, sub := range schema.OneOf {
+			if coerced, violations := v.check(sub, value, path); len(violations) == 0 {
+				matches++
+				match = coerced
+			}
+		}
+		if matches == 1 {
+			value = match
+		} else {
+			v.fail(path, "oneOf", "value must match exactly one of %d schemas, matched %d", len(schema.OneOf), matches)
+		}
+	}
+
+	if schema.Not != nil {
+		if _, violations := v.check(schema.Not, value, path); len(violations) == 0 {
+			v.fail(path, "not", "value must not match the schema")
+		}
+	}
+	return value
+}
+
+// coerceType converts safe type mismatches when coercion is enabled
+func (v *validator) coerceType(schema *Schema, value any) any {
+	if !v.coerce || hasJSONType(value, schema.Type) {
+		return value
+	}
+
+	switch schema.Type {
+	case "integer", "number":
+		if s, ok := value.(string); ok {
+			if n, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+				return n
+			}
+		}
+	case "boolean":
+		if s, ok := value.(string); ok {
+			switch strings.ToLower(strings.TrimSpace(s)) {
+			case "true":
+				return true
+			case "false":
+				return false
+			}
+		}
+	case "array":
+		if _, ok := value.(map[string]any); !ok {
+			return []any{value}
+		}
+	}
+	return value
+}
+
+// hasJSONType reports whether the value is of the JSON Schema type
+func hasJSONType(value any, typ string) bool {
+	switch typ {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "integer":
+		n, ok := toFloat(value)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "null":
+		return value == nil
+	}
+	// Unknown types are not checked
+	return true
+}
+
+func jsonTypeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	if n, ok := toFloat(value); ok {
+		if n == math.Trunc(n) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// toFloat converts JSON and Go numbers
+func toFloat(value any) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// jsonEqual compares values by their JSON encoding, so 1 equals 1.0
+func jsonEqual(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return mustJSON(a) == mustJSON(b)
+}
+
+// sameValue reports whether validation returned the value unchanged
+func sameValue(a, b any) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() {
+		return va.IsValid() == vb.IsValid()
+	}
+	if va.Type() != vb.Type() {
+		return false
+	}
+	switch va.Kind() {
+	case reflect.Map, reflect.Slice:
+		return va.UnsafePointer() == vb.UnsafePointer() && va.Len() == vb.Len()
+	}
+	return !va.Comparable() || va.Equal(vb)
+}
+
+func mustJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func escapePointerToken(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
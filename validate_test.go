@@ -0,0 +1,193 @@
+package apiai
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func validationFunction() *FunctionDefinition {
+	minLen, maxItems := 2, 2
+	min, multiple := 1.0, 0.5
+	return &FunctionDefinition{
+		Name: "create_order",
+		Parameters: Schema{
+			Type:     "object",
+			Required: []string{"quantity", "requestBody"},
+			Properties: map[string]*Schema{
+				"quantity": {Type: "integer", Minimum: &min},
+				"express":  {Type: "boolean"},
+				"tags":     {Type: "array", Items: &Schema{Type: "string", MinLength: &minLen}, MaxItems: &maxItems},
+				"requestBody": {
+					Type:     "object",
+					Required: []string{"item"},
+					Properties: map[string]*Schema{
+						"item":   {Type: "string", Enum: []any{"apple", "pear"}},
+						"weight": {Type: "number", MultipleOf: &multiple},
+						"note":   {Type: "string", Nullable: true, Pattern: "^[a-z ]*$"},
+						"id":     {AnyOf: []*Schema{{Type: "integer"}, {Type: "string", Format: "uuid"}}},
+					},
+					AdditionalProperties: &AdditionalProperties{Allowed: false},
+				},
+			},
+		},
+	}
+}
+
+func TestValidateArguments(t *testing.T) {
+	fn := validationFunction()
+
+	valid := map[string]any{
+		"quantity":    float64(2),
+		"tags":        []any{"gift"},
+		"requestBody": map[string]any{"item": "apple", "weight": 1.5, "note": nil, "id": "abc"},
+	}
+	if _, err := ValidateArguments(fn, valid, false); err != nil {
+		t.Errorf("Expected valid arguments, got %v", err)
+	}
+
+	invalid := map[string]any{
+		"quantity": "5",
+		"express":  "yes",
+		"tags":     []any{"a", "bb", "cc"},
+		"requestBody": map[string]any{
+			"item":   "banana",
+			"weight": 1.2,
+			"note":   "UPPER",
+			"id":     true,
+			"extra":  1,
+		},
+	}
+	_, err := ValidateArguments(fn, invalid, false)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+
+	got := map[string]string{}
+	for _, v := range verr.Violations {
+		got[v.Path] = v.Keyword
+	}
+	want := map[string]string{
+		"/quantity":           "type",
+		"/express":            "type",
+		"/tags":               "maxItems",
+		"/tags/0":             "minLength",
+		"/requestBody/item":   "enum",
+		"/requestBody/weight": "multipleOf",
+		"/requestBody/note":   "pattern",
+		"/requestBody/id":     "anyOf",
+		"/requestBody/extra":  "additionalProperties",
+	}
+	for path, keyword := range want {
+		if got[path] != keyword {
+			t.Errorf("%s: expected %q violation, got %q", path, keyword, got[path])
+		}
+	}
+	if len(verr.Violations) != len(want) {
+		t.Errorf("Expected %d violations, got %+v", len(want), verr.Violations)
+	}
+
+	// The message can be sent back to the model as is
+	msg := err.Error()
+	var violations []Violation
+	if i := strings.Index(msg, "["); i < 0 || json.Unmarshal([]byte(msg[i:]), &violations) != nil || len(violations) != len(want) {
+		t.Errorf("Expected violations as JSON in the message, got %q", msg)
+	}
+
+	// Missing required arguments
+	_, err = ValidateArguments(fn, map[string]any{"requestBody": map[string]any{}}, false)
+	if !errors.As(err, &verr) || len(verr.Violations) != 2 {
+		t.Fatalf("Expected 2 required violations, got %v", err)
+	}
+	for _, v := range verr.Violations {
+		if v.Keyword != "required" {
+			t.Errorf("Unexpected violation %+v", v)
+		}
+	}
+}
+
+func TestValidateArgumentsCoerce(t *testing.T) {
+	fn := validationFunction()
+
+	args := map[string]any{
+		"quantity":    "3",
+		"express":     "TRUE",
+		"tags":        "gift",
+		"requestBody": map[string]any{"item": "pear", "weight": "2.5", "id": "7"},
+	}
+	coerced, err := ValidateArguments(fn, args, true)
+	if err != nil {
+		t.Fatalf("Expected coercion to succeed, got %v", err)
+	}
+
+	if coerced["quantity"] != float64(3) || coerced["express"] != true {
+		t.Errorf("Unexpected coerced scalars %+v", coerced)
+	}
+	if tags, ok := coerced["tags"].([]any); !ok || len(tags) != 1 || tags[0] != "gift" {
+		t.Errorf("Expected single value to be wrapped, got %+v", coerced["tags"])
+	}
+	body := coerced["requestBody"].(map[string]any)
+	if body["weight"] != 2.5 || body["id"] != float64(7) {
+		t.Errorf("Unexpected coerced body %+v", body)
+	}
+	if args["quantity"] != "3" || args["requestBody"].(map[string]any)["weight"] != "2.5" {
+		t.Errorf("Expected input arguments to be left untouched, got %+v", args)
+	}
+
+	// Not a safe case
+	if _, err := ValidateArguments(fn, map[string]any{"quantity": "3.5", "requestBody": map[string]any{"item": "pear"}}, true); err == nil {
+		t.Errorf("Expected a fractional quantity to be rejected")
+	}
+}
+
+func TestExecuteFunctionValidation(t *testing.T) {
+	var requests int
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		gotQuery = r.URL.RawQuery
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(srv.URL, &AuthConfig{Type: AuthTypeNone})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	client.ValidateArguments = true
+
+	fn := validationFunction()
+	fn.OapiMethod, fn.OapiPath = http.MethodPost, "/orders"
+	fn.QueryParams = []string{"quantity"}
+
+	_, err = ExecuteFunction(client, fn, map[string]any{"quantity": "2", "requestBody": map[string]any{"item": "pear"}})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || requests != 0 {
+		t.Fatalf("Expected ValidationError before any request, got %v", err)
+	}
+
+	client.CoerceArguments = true
+	if _, err := ExecuteFunction(client, fn, map[string]any{"quantity": "2", "requestBody": map[string]any{"item": "pear"}}); err != nil {
+		t.Fatalf("Expected coerced call to succeed, got %v", err)
+	}
+	if gotQuery != "quantity=2" {
+		t.Errorf("Unexpected query %q", gotQuery)
+	}
+
+	// Null optional arguments are absent, as without validation
+	fn.QueryParams = []string{"quantity", "express"}
+	if _, err := ExecuteFunction(client, fn, map[string]any{"quantity": 2, "express": nil, "requestBody": map[string]any{"item": "pear"}}); err != nil {
+		t.Fatalf("Expected a null optional argument to be accepted, got %v", err)
+	}
+	if gotQuery != "quantity=2" {
+		t.Errorf("Unexpected query %q", gotQuery)
+	}
+	_, err = ExecuteFunction(client, fn, map[string]any{"quantity": nil, "requestBody": map[string]any{"item": "pear"}})
+	if !errors.As(err, &verr) || verr.Violations[0].Path != "/quantity" {
+		t.Errorf("Expected a null required argument to be rejected, got %v", err)
+	}
+}